@@ -17,10 +17,10 @@ func NewAcrobatCommand(out io.Writer) *cobra.Command {
 		Short: "podacrobat",
 		Long:  "podacrobat",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := app.Config.Validate(); err != nil {
+			if err := app.Validate(); err != nil {
 				log.Fatalf("validate config failed: %v", err)
 			}
-			err := Run(app)
+			err := Run(app, out)
 			if err != nil {
 				log.Printf("%v", err)
 			}
@@ -28,13 +28,16 @@ func NewAcrobatCommand(out io.Writer) *cobra.Command {
 	}
 	cmd.SetOutput(out)
 
-	flags := cmd.Flags()
+	// shared by the one-shot run and the controller mode
+	flags := cmd.PersistentFlags()
 	flags.AddGoFlagSet(flag.CommandLine)
 	app.AddFlags(flags)
 
+	cmd.AddCommand(NewControllerCommand(app, out))
+
 	return cmd
 }
 
-func Run(app *config.PodAcrobat) error {
-	return acrobat.Run(app)
+func Run(app *config.PodAcrobat, out io.Writer) error {
+	return acrobat.Run(app, out)
 }
@@ -1,22 +1,61 @@
 package config
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/pflag"
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/strategy"
 
 	clientset "k8s.io/client-go/kubernetes"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
 type PodAcrobat struct {
 	Config
 	Client clientset.Interface
+	// metrics.k8s.io client, used by the metrics usage source
+	MetricsClient metricsclientset.Interface
+
+	// out-of-cluster access, fall back to incluster config when all empty
+	Kubeconfig string
+	Context    string
+	Master     string
+
+	// record the eviction plan without calling the eviction api
+	DryRun bool
+	// report format, json or yaml, empty for logs only
+	Output string
+	// metrics of a one-shot run are pushed here, empty to disable
+	PushgatewayURL string
 }
 
 func (pa *PodAcrobat) AddFlags(fs *pflag.FlagSet) {
-	fs.StringVar(&pa.Policy, "policy", PodsCount, "nodes filter policy(use \"podscount\" for test)")
-	fs.IntVar(&pa.IdleCountThreshold, "lowerthreshold", 30, "lower threshold")
-	fs.IntVar(&pa.EvictCountThreshold, "upperthreshold", 50, "upper threshold")
-	fs.Float64Var(&pa.CpuUtilIdleThreshold, "util-cpu-idle-threshold", 20, "util cpu idle threshold")
-	fs.Float64Var(&pa.CpuUtilEvictThreshold, "util-cpu-evict-threshold", 60, "util cpu evict threshold")
-	fs.Float64Var(&pa.MemUtilIdleThreshold, "util-memory-idle-threshold", 20, "util memory idle threshold")
-	fs.Float64Var(&pa.MemUtilEvictThreshold, "util-memory-evict-threshold", 60, "util memory evict threshold")
+	fs.StringVar(&pa.Kubeconfig, "kubeconfig", "", "path to kubeconfig file, KUBECONFIG env or ~/.kube/config is used if not set, incluster config if none is found and no client flag is set")
+	fs.StringVar(&pa.Context, "context", "", "kubeconfig context to use")
+	fs.StringVar(&pa.Master, "master", "", "address of the kubernetes api server, overrides any value in kubeconfig")
+	fs.BoolVar(&pa.DryRun, "dry-run", false, "print the pods that would be evicted without evicting them")
+	fs.StringVarP(&pa.Output, "output", "o", "", "print the run report in the given format, one of: json, yaml")
+	fs.StringVar(&pa.PushgatewayURL, "pushgateway-url", "", "push metrics of a one-shot run to this pushgateway, e.g. http://pushgateway:9091")
+	fs.StringSliceVar(&pa.Policies, "policy", []string{DefaultPolicy},
+		fmt.Sprintf("comma separated policies run in order, available: %s", strings.Join(strategy.Names(), ", ")))
+	fs.IntVar(&pa.MaxPodsToEvict, "max-pods-to-evict", 0, "max pods evicted per run by all policies, 0 for unlimited")
+	fs.StringSliceVar(&pa.Namespaces, "namespaces", nil, "comma separated namespaces to evict pods from, all if empty")
+	fs.StringSliceVar(&pa.ExcludeNamespaces, "exclude-namespaces", nil, "comma separated namespaces to never evict pods from")
+	fs.StringVar(&pa.PodSelector, "pod-selector", "", "label selector of the pods to evict, e.g. tier=batch")
+	fs.StringVar(&pa.NodeSelector, "node-selector", "", "label selector of the nodes to balance, e.g. kubernetes.io/os=linux")
+	fs.BoolVar(&pa.NodeEligibility.ExcludePressure, "exclude-pressure-nodes", true, "leave nodes under memory, disk or pid pressure out of balancing")
+	fs.BoolVar(&pa.NodeEligibility.ExcludeTainted, "exclude-tainted-nodes", false, "leave nodes with NoSchedule or NoExecute taints out of balancing")
+	fs.BoolVar(&pa.NodeEligibility.ExcludeControlPlane, "exclude-control-plane-nodes", true, "leave control plane nodes out of balancing")
+	fs.BoolVar(&pa.NodeEligibility.ExcludeCordoned, "exclude-cordoned-nodes", true, "leave unschedulable nodes out of balancing")
+	fs.StringVar(&pa.BalanceGroupLabel, "balance-group-label", "", "balance nodes within groups sharing this label value, e.g. a node pool or zone label")
+	strategy.AddFlags(fs)
+}
+
+func (pa *PodAcrobat) Validate() error {
+	if err := report.ValidateOutput(pa.Output); err != nil {
+		return err
+	}
+	return pa.Config.Validate()
 }
@@ -4,74 +4,76 @@ import (
 	"errors"
 	"fmt"
 	"log"
-)
 
-type Policy string
+	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/strategy"
 
-const (
-	PodsCount string = "podscount"
-	NodesLoad string = "nodesutil"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
+const DefaultPolicy = "podscount"
+
 type Config struct {
-	Policy string
+	// strategies run in order, sharing one snapshot and eviction budget
+	Policies []string
+	// max pods evicted per run across all strategies, 0 for unlimited
+	MaxPodsToEvict int
 
-	EvictCountThreshold int
-	IdleCountThreshold  int
+	// candidate pods filter, filtered pods still count for node usage
+	Namespaces        []string
+	ExcludeNamespaces []string
+	PodSelector       string
 
-	// care cpu & memory only
-	// unit is percentage
-	CpuUtilEvictThreshold float64
-	CpuUtilIdleThreshold  float64
-	MemUtilEvictThreshold float64
-	MemUtilIdleThreshold  float64
+	// only nodes matching the selector are balanced
+	NodeSelector string
+	// nodes are balanced within groups sharing this label value, e.g. per
+	// node pool or zone, empty for one group
+	BalanceGroupLabel string
+	// rules excluding nodes from balancing besides not ready ones
+	NodeEligibility resources.NodeEligibility
 }
 
 func (cfg *Config) Validate() error {
 	log.Printf("config: %#v", *cfg)
-	if cfg.Policy == PodsCount {
-		if err := lessThan(float64(cfg.IdleCountThreshold), float64(cfg.EvictCountThreshold)); err != nil {
-			return err
-		}
-	} else if cfg.Policy == NodesLoad {
-		if err := validateUtilPercentage(cfg.CpuUtilEvictThreshold); err != nil {
-			return err
-		}
-		if err := validateUtilPercentage(cfg.CpuUtilIdleThreshold); err != nil {
-			return err
-		}
-		if err := lessThan(cfg.CpuUtilIdleThreshold, cfg.CpuUtilEvictThreshold); err != nil {
-			return err
-		}
-		if err := validateUtilPercentage(cfg.MemUtilEvictThreshold); err != nil {
-			return err
-		}
-		if err := validateUtilPercentage(cfg.MemUtilIdleThreshold); err != nil {
-			return err
+	if len(cfg.Policies) == 0 {
+		return errors.New("at least one policy is required")
+	}
+	if cfg.MaxPodsToEvict < 0 {
+		return fmt.Errorf("illegal max pods to evict %d", cfg.MaxPodsToEvict)
+	}
+	if len(cfg.Namespaces) > 0 && len(cfg.ExcludeNamespaces) > 0 {
+		return errors.New("namespaces and exclude namespaces are mutually exclusive")
+	}
+	if _, err := cfg.PodFilter(); err != nil {
+		return err
+	}
+	if _, err := cfg.NodeLabelSelector(); err != nil {
+		return err
+	}
+	seen := make(map[string]struct{})
+	for _, policy := range cfg.Policies {
+		if _, ok := seen[policy]; ok {
+			return fmt.Errorf("duplicated policy %q", policy)
 		}
-		if err := lessThan(cfg.MemUtilIdleThreshold, cfg.MemUtilEvictThreshold); err != nil {
+		seen[policy] = struct{}{}
+		if err := strategy.Validate(policy); err != nil {
 			return err
 		}
-	} else {
-		return fmt.Errorf("unsupported police %q", cfg.Policy)
 	}
-
 	return nil
 }
 
-var ErrIllegalUtil = errors.New("illegal util percentage")
-
-func validateUtilPercentage(f float64) error {
-	if f < 0 || f > 100 {
-		return ErrIllegalUtil
-	}
-
-	return nil
+func (cfg *Config) PodFilter() (*resources.PodFilter, error) {
+	return resources.NewPodFilter(cfg.Namespaces, cfg.ExcludeNamespaces, cfg.PodSelector)
 }
 
-func lessThan(f1, f2 float64) error {
-	if f1 > f2 {
-		return fmt.Errorf("parameter not matched")
+func (cfg *Config) NodeLabelSelector() (labels.Selector, error) {
+	if cfg.NodeSelector == "" {
+		return labels.Everything(), nil
 	}
-	return nil
+	selector, err := labels.Parse(cfg.NodeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("parse node selector %q failed: %v", cfg.NodeSelector, err)
+	}
+	return selector, nil
 }
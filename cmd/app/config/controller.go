@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type ControllerOptions struct {
+	// time between two balance passes
+	Interval time.Duration
+	// pods of an owner evicted within the cooldown are not evicted again
+	Cooldown time.Duration
+	// serve /metrics on this address, empty to disable
+	MetricsAddress string
+	LeaderElection LeaderElectionOptions
+}
+
+func (co *ControllerOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.DurationVar(&co.Interval, "interval", 5*time.Minute, "time between two balance passes")
+	fs.DurationVar(&co.Cooldown, "cooldown", 30*time.Minute, "do not evict pods of an owner again within this duration")
+	fs.StringVar(&co.MetricsAddress, "metrics-bind-address", ":8080", "address to serve prometheus metrics on, empty to disable")
+	co.LeaderElection.AddFlags(fs)
+}
+
+func (co *ControllerOptions) Validate() error {
+	if co.Interval <= 0 {
+		return fmt.Errorf("illegal interval %v", co.Interval)
+	}
+	if co.Cooldown < 0 {
+		return fmt.Errorf("illegal cooldown %v", co.Cooldown)
+	}
+	return co.LeaderElection.Validate()
+}
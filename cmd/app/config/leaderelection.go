@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type LeaderElectionOptions struct {
+	// only the lease holder evicts pods
+	LeaderElect    bool
+	LeaseName      string
+	LeaseNamespace string
+	// followers wait this long after the last renew to take over
+	LeaseDuration time.Duration
+	// the leader gives up if it can not renew within this duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+func (lo *LeaderElectionOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&lo.LeaderElect, "leader-elect", false, "elect a leader with a lease so only one replica evicts pods")
+	fs.StringVar(&lo.LeaseName, "leader-elect-lease-name", "podacrobat", "name of the leader election lease")
+	fs.StringVar(&lo.LeaseNamespace, "leader-elect-lease-namespace", "kube-system", "namespace of the leader election lease")
+	fs.DurationVar(&lo.LeaseDuration, "leader-elect-lease-duration", 15*time.Second, "time followers wait after the last renew before taking over")
+	fs.DurationVar(&lo.RenewDeadline, "leader-elect-renew-deadline", 10*time.Second, "time the leader retries renewing before it stops evicting")
+	fs.DurationVar(&lo.RetryPeriod, "leader-elect-retry-period", 2*time.Second, "time between two acquire or renew attempts")
+}
+
+func (lo *LeaderElectionOptions) Validate() error {
+	if !lo.LeaderElect {
+		return nil
+	}
+	if lo.LeaseName == "" || lo.LeaseNamespace == "" {
+		return fmt.Errorf("leader election lease name and namespace required")
+	}
+	if lo.RetryPeriod <= 0 {
+		return fmt.Errorf("illegal leader election retry period %v", lo.RetryPeriod)
+	}
+	if lo.RenewDeadline <= lo.RetryPeriod {
+		return fmt.Errorf("leader election renew deadline %v must be greater than retry period %v", lo.RenewDeadline, lo.RetryPeriod)
+	}
+	if lo.LeaseDuration <= lo.RenewDeadline {
+		return fmt.Errorf("leader election lease duration %v must be greater than renew deadline %v", lo.LeaseDuration, lo.RenewDeadline)
+	}
+	return nil
+}
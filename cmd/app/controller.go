@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/stepdc/podacrobat/cmd/app/config"
+	"github.com/stepdc/podacrobat/pkg/acrobat"
+	"github.com/stepdc/podacrobat/pkg/controller"
+	"github.com/stepdc/podacrobat/pkg/election"
+	"github.com/stepdc/podacrobat/pkg/metrics"
+)
+
+func NewControllerCommand(app *config.PodAcrobat, out io.Writer) *cobra.Command {
+	opts := &config.ControllerOptions{}
+	cmd := &cobra.Command{
+		Use:   "controller",
+		Short: "run podacrobat continuously",
+		Long:  "run podacrobat continuously, rebalancing on a fixed interval",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := app.Validate(); err != nil {
+				log.Fatalf("validate config failed: %v", err)
+			}
+			if err := opts.Validate(); err != nil {
+				log.Fatalf("validate controller config failed: %v", err)
+			}
+			if err := RunController(app, opts, out); err != nil {
+				log.Fatalf("%v", err)
+			}
+		},
+	}
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func RunController(app *config.PodAcrobat, opts *config.ControllerOptions, out io.Writer) error {
+	a, err := acrobat.New(app, out)
+	if err != nil {
+		return err
+	}
+	if opts.MetricsAddress != "" {
+		metrics.Serve(opts.MetricsAddress)
+	}
+	ctx := signalContext()
+	// followers keep the caches warm to take over quickly
+	if err := a.Start(ctx); err != nil {
+		return err
+	}
+	c := controller.New(a, opts.Interval, opts.Cooldown)
+	if !opts.LeaderElection.LeaderElect {
+		c.Run(ctx)
+		return nil
+	}
+	return election.Run(ctx, app.Client, opts.LeaderElection, c.Run)
+}
+
+// signalContext is canceled on SIGTERM or SIGINT, a second signal exits.
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-c
+		log.Printf("received %v, shutting down", sig)
+		cancel()
+		<-c
+		os.Exit(1)
+	}()
+	return ctx
+}
@@ -0,0 +1,10 @@
+package app
+
+import (
+	// register in-tree strategies
+	_ "github.com/stepdc/podacrobat/pkg/algorithms/antiaffinity"
+	_ "github.com/stepdc/podacrobat/pkg/algorithms/count"
+	_ "github.com/stepdc/podacrobat/pkg/algorithms/duplicates"
+	_ "github.com/stepdc/podacrobat/pkg/algorithms/nodeaffinity"
+	_ "github.com/stepdc/podacrobat/pkg/algorithms/util"
+)
@@ -2,7 +2,6 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"log"
 	"os"
 
@@ -10,7 +9,6 @@ import (
 )
 
 func main() {
-	fmt.Println("fmt start")
 	out := os.Stdout
 	cmd := app.NewAcrobatCommand(out)
 	flag.CommandLine.Parse([]string{})
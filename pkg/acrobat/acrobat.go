@@ -3,66 +3,224 @@ package acrobat
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"sort"
 	"time"
 
-	"github.com/stepdc/podacrobat/pkg/algorithms/util"
-
 	"github.com/stepdc/podacrobat/cmd/app/config"
-	"github.com/stepdc/podacrobat/pkg/algorithms/count"
+	"github.com/stepdc/podacrobat/pkg/metrics"
+	"github.com/stepdc/podacrobat/pkg/report"
 	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/strategy"
 
+	"k8s.io/apimachinery/pkg/labels"
 	clientset "k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
 const defaultTimeout = 30 * time.Second
 
-func Run(pa *config.PodAcrobat) error {
-	log.Printf("start balance")
-	// incluster supported only
-	cfg, err := rest.InClusterConfig()
+// Acrobat runs balance passes against one cluster, the clients and the
+// eviction history are kept between passes in controller mode.
+type Acrobat struct {
+	pa          *config.PodAcrobat
+	out         io.Writer
+	history     *resources.EvictionHistory
+	snapshotter *resources.Snapshotter
+	// nil in dry run mode, nothing happens to explain
+	recorder *eventRecorder
+	filter   *resources.PodFilter
+	nodes    labels.Selector
+}
+
+func New(pa *config.PodAcrobat, out io.Writer) (*Acrobat, error) {
+	// client may be injected, e.g. a fake clientset in tests
+	if pa.Client == nil {
+		cfg, err := buildConfig(pa)
+		if err != nil {
+			return nil, err
+		}
+		cli, err := clientset.NewForConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("build client failed: %v", err)
+		}
+		pa.Client = cli
+		metricsCli, err := metricsclientset.NewForConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("build metrics client failed: %v", err)
+		}
+		pa.MetricsClient = metricsCli
+	}
+	filter, err := pa.PodFilter()
 	if err != nil {
-		return fmt.Errorf("could not generated incluster configuration for kubernetes: %v", err)
+		return nil, err
 	}
-	cli, err := clientset.NewForConfig(cfg)
+	nodes, err := pa.NodeLabelSelector()
 	if err != nil {
-		return fmt.Errorf("build client failed: %v", err)
+		return nil, err
+	}
+	a := &Acrobat{pa: pa, out: out, snapshotter: resources.NewSnapshotter(pa.Client), filter: filter, nodes: nodes}
+	if !pa.DryRun {
+		a.recorder = newEventRecorder(pa.Client)
 	}
-	pa.Client = cli
+	return a, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
+// Start fills the node, pod and pdb caches, they are kept up to date by
+// watches until ctx is done so each pass reads a fresh snapshot for free.
+func (a *Acrobat) Start(ctx context.Context) error {
+	log.Printf("start informers")
+	if err := a.snapshotter.Start(ctx, defaultTimeout); err != nil {
+		return fmt.Errorf("sync cache failed: %v", err)
+	}
+	return nil
+}
 
-	log.Printf("start fetch nodes")
-	avaliableNodes, err := resources.ListNodes(ctx, pa.Client)
+// SetHistory makes following passes skip pods whose owner was evicted
+// within the history cooldown.
+func (a *Acrobat) SetHistory(h *resources.EvictionHistory) {
+	a.history = h
+}
+
+// Run runs one balance pass and exits, the CronJob mode.
+func Run(pa *config.PodAcrobat, out io.Writer) error {
+	a, err := New(pa, out)
 	if err != nil {
-		return fmt.Errorf("filter nodes failed: %v", err)
+		return err
 	}
-	if len(avaliableNodes) == 0 {
-		log.Printf("no avaiable nodes found")
-		// noready nodes
-		return nil
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := a.Start(ctx); err != nil {
+		return err
 	}
+	err = a.RunOnce(ctx)
+	if a.recorder != nil {
+		a.recorder.flush(eventFlushTimeout)
+	}
+	if pa.PushgatewayURL != "" {
+		if perr := metrics.Push(pa.PushgatewayURL, "podacrobat", err == nil); perr != nil {
+			log.Printf("push metrics failed: %v", perr)
+		}
+	}
+	return err
+}
+
+// RunOnce runs one balance pass on the cached snapshot, Start must have
+// returned first. Evictions stop as soon as ctx is done.
+func (a *Acrobat) RunOnce(ctx context.Context) (err error) {
+	pa := a.pa
+	log.Printf("start balance")
+	start := time.Now()
+	defer func() {
+		metrics.ObserveRun(start, err)
+	}()
 
-	groupedPods, err := resources.GroupPodsByNode(cli, avaliableNodes)
+	rep := report.New(pa.Policies, pa.DryRun)
+	snapshot, err := a.snapshotter.Snapshot(a.nodes)
+	if err != nil {
+		return err
+	}
+	groupedPods, excluded := resources.FilterEligibleNodes(snapshot, &pa.NodeEligibility)
+	for name, reason := range excluded {
+		log.Printf("exclude node %s: %s", name, reason)
+		rep.AddExcludedNode(name, reason)
+	}
+	pdbs, err := a.snapshotter.PodDisruptionBudgets()
+	if err != nil {
+		return err
+	}
+	namespaces, err := a.snapshotter.Namespaces()
 	if err != nil {
 		return err
 	}
 
-	// TODO: use algo interface here
-	log.Printf("evict pods")
-	var algo algoInterface
-	if pa.Config.Policy == config.PodsCount {
-		algo = count.NewPodCountAlgo(pa.Config)
-	} else if pa.Config.Policy == config.NodesLoad {
-		algo = util.NewCpuMemUtilAlgo(pa.Config)
+	pe := resources.NewPodEvictor(pa.Client, pa.DryRun)
+	pe.SetContext(ctx)
+	pe.SetMaxPods(pa.MaxPodsToEvict)
+	pe.SetPodDisruptionBudgets(pdbs)
+	pe.SetNamespaces(namespaces)
+	pe.SetPodFilter(a.filter)
+	if a.history != nil {
+		pe.SetHistory(a.history)
+	}
+	if a.recorder != nil {
+		pe.SetRecorder(a.recorder)
+	}
+	if len(groupedPods) == 0 {
+		// still write the report, it tells why the nodes are excluded
+		log.Printf("no avaiable nodes found")
 	} else {
-		log.Fatalf("unsupported policy: %q", pa.Config.Policy)
+		err = runPipeline(pa, pe, groupedPods, rep)
+	}
+	metrics.ObserveReport(rep)
+	if pa.Output != "" {
+		fillReport(rep, pe, err)
+		if werr := rep.Write(a.out, pa.Output); werr != nil {
+			log.Printf("write report failed: %v", werr)
+		}
+	} else if pa.DryRun {
+		pe.PrintPlan(a.out)
 	}
-	return algo.Run(pa.Client, groupedPods)
+	return err
 }
 
-type algoInterface interface {
-	Run(cli clientset.Interface, nodePods map[string]resources.NodeInfoWithPods) error
+// runPipeline runs the policies in order, each one sees the snapshot
+// without the pods evicted by the previous ones. A load balancing policy
+// runs on each balance group on its own.
+func runPipeline(pa *config.PodAcrobat, pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.Report) error {
+	h := strategy.Handle{Client: pa.Client, MetricsClient: pa.MetricsClient}
+	for _, policy := range pa.Policies {
+		if pe.Stopped() {
+			log.Printf("run canceled, skip policy %q", policy)
+			break
+		}
+		if pe.Exhausted() {
+			log.Printf("eviction budget %d used up, skip policy %q", pa.MaxPodsToEvict, policy)
+			break
+		}
+		algo, err := strategy.New(policy, h)
+		if err != nil {
+			return err
+		}
+		log.Printf("evict pods by policy %q", policy)
+		pe.SetStrategy(policy)
+		var groupLabel string
+		if strategy.Balances(policy) {
+			groupLabel = pa.BalanceGroupLabel
+		}
+		groups := resources.GroupNodesByLabel(nodePods, groupLabel)
+		for _, name := range sortedGroups(groups) {
+			if groupLabel != "" {
+				log.Printf("balance group %s=%q, %d nodes", groupLabel, name, len(groups[name]))
+			}
+			if err := algo.Run(pe, groups[name], rep.Strategy(policy)); err != nil {
+				return fmt.Errorf("policy %q failed: %v", policy, err)
+			}
+		}
+		nodePods = resources.RemoveEvictedPods(nodePods, pe)
+	}
+	return nil
+}
+
+func sortedGroups(groups map[string]map[string]resources.NodeInfoWithPods) []string {
+	var ret []string
+	for name := range groups {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func fillReport(rep *report.Report, pe *resources.PodEvictor, err error) {
+	for _, e := range pe.Evicted() {
+		rep.AddEvicted(e.Pod, e.Node, e.Strategy, e.Reason)
+	}
+	for _, e := range pe.Skipped() {
+		rep.AddSkipped(e.Pod, e.Node, e.Strategy, e.Reason)
+	}
+	if err != nil {
+		rep.AddError(err)
+	}
+	rep.EndTime = time.Now()
 }
@@ -0,0 +1,298 @@
+package acrobat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stepdc/podacrobat/cmd/app/config"
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/strategy"
+	"github.com/stepdc/podacrobat/pkg/usage"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// pods seen by the strategies of the pipeline test, by strategy name
+var seenPods = make(map[string][]string)
+
+// node cpu usage in millicores seen by the metrics strategy, by node name
+var seenCPU = make(map[string]int64)
+
+// node counts of the runs of the group strategies, by strategy name
+var seenGroups = make(map[string][]int)
+
+type groupStrategy struct {
+	name string
+}
+
+func (s groupStrategy) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	seenGroups[s.name] = append(seenGroups[s.name], len(nodePods))
+	return nil
+}
+
+// evictStrategy evicts all pods it sees on the nodes, or on node only if set.
+type evictStrategy struct {
+	name, node string
+}
+
+func (s evictStrategy) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	var names []string
+	for name := range nodePods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, pod := range nodePods[name].Pods {
+			seenPods[s.name] = append(seenPods[s.name], pod.Name)
+		}
+		if s.node != "" && name != s.node {
+			continue
+		}
+		if _, _, err := resources.EvictPods(pe, nodePods[name].Pods, resources.Reason{Code: "Test", Message: s.name}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricsStrategy records node usage measured by metrics.k8s.io.
+type metricsStrategy struct {
+	source resources.UsageSource
+}
+
+func (s metricsStrategy) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	for name, info := range nodePods {
+		nodeUsage := s.source.NodeUsage(info)
+		seenCPU[name] = nodeUsage.Cpu().MilliValue()
+	}
+	return nil
+}
+
+func init() {
+	for _, s := range []evictStrategy{{name: "test-node1", node: "node1"}, {name: "test-all"}} {
+		s := s
+		strategy.Register(strategy.Registration{
+			Name: s.name,
+			New:  func(strategy.Handle) (strategy.Strategy, error) { return s, nil },
+		})
+	}
+	for _, r := range []strategy.Registration{{Name: "test-balance", Balances: true}, {Name: "test-violation"}} {
+		r, s := r, groupStrategy{name: r.Name}
+		r.New = func(strategy.Handle) (strategy.Strategy, error) { return s, nil }
+		strategy.Register(r)
+	}
+	strategy.Register(strategy.Registration{
+		Name: "test-metrics",
+		New: func(h strategy.Handle) (strategy.Strategy, error) {
+			source, err := usage.New(usage.Options{Source: usage.SourceMetrics}, h.MetricsClient)
+			if err != nil {
+				return nil, err
+			}
+			return metricsStrategy{source: source}, nil
+		},
+	})
+}
+
+func TestRunOncePipeline(t *testing.T) {
+	objects := []runtime.Object{genTestNode("node1"), genTestNode("node2")}
+	for _, pod := range []struct{ name, node string }{{"a", "node1"}, {"b", "node1"}, {"c", "node2"}, {"d", "node2"}} {
+		objects = append(objects, genTestPod(pod.name, pod.node))
+	}
+	pa := &config.PodAcrobat{
+		Config: config.Config{
+			Policies:       []string{"test-node1", "test-all"},
+			MaxPodsToEvict: 3,
+		},
+		Client: fake.NewSimpleClientset(objects...),
+		DryRun: true,
+		Output: report.OutputJSON,
+	}
+	var out bytes.Buffer
+	a, err := New(pa, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := a.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second policy does not see the pods evicted by the first one
+	seen := seenPods["test-all"]
+	sort.Strings(seen)
+	if !reflect.DeepEqual(seen, []string{"c", "d"}) {
+		t.Errorf("expected second policy to see c and d only, got %v", seen)
+	}
+	// the budget of 3 is shared, one pod of node2 is left
+	var rep report.Report
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	evicted := make(map[string][]string)
+	for _, e := range rep.Evicted {
+		evicted[e.Strategy] = append(evicted[e.Strategy], e.Name)
+	}
+	first := evicted["test-node1"]
+	sort.Strings(first)
+	if !reflect.DeepEqual(first, []string{"a", "b"}) || len(evicted["test-all"]) != 1 {
+		t.Errorf("expected a and b evicted by the first policy and one pod by the second, got %v", evicted)
+	}
+}
+
+func TestRunOncePipelineGroups(t *testing.T) {
+	objects := []runtime.Object{genTestNode("node1"), genTestNode("node2"), genTestNode("node3")}
+	for _, obj := range objects[:2] {
+		obj.(*v1.Node).Labels = map[string]string{"pool": "a"}
+	}
+	pa := &config.PodAcrobat{
+		Config: config.Config{
+			Policies:          []string{"test-balance", "test-violation"},
+			BalanceGroupLabel: "pool",
+		},
+		Client: fake.NewSimpleClientset(objects...),
+		DryRun: true,
+	}
+	a, err := New(pa, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := a.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// node3 without the label makes up a group of its own
+	if got := seenGroups["test-balance"]; !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("expected balancing policy run on groups of 1 and 2 nodes, got %v", got)
+	}
+	if got := seenGroups["test-violation"]; !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("expected violation policy run on all 3 nodes, got %v", got)
+	}
+}
+
+func TestRunOncePipelineMetrics(t *testing.T) {
+	objects := []runtime.Object{genTestNode("node1"), genTestNode("node2")}
+	for _, pod := range []struct{ name, node string }{{"a", "node1"}, {"b", "node1"}, {"c", "node2"}} {
+		objects = append(objects, genTestPod(pod.name, pod.node))
+	}
+	metricsCli := &metricsfake.Clientset{}
+	metricsCli.AddReactor("list", "nodes", func(action core.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.NodeMetricsList{Items: []metricsv1beta1.NodeMetrics{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Usage: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Usage: v1.ResourceList{v1.ResourceCPU: resource.MustParse("300m")}},
+		}}, nil
+	})
+	metricsCli.AddReactor("list", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		var items []metricsv1beta1.PodMetrics
+		for _, name := range []string{"a", "b", "c"} {
+			items = append(items, metricsv1beta1.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+				Containers: []metricsv1beta1.ContainerMetrics{{Name: "app", Usage: v1.ResourceList{v1.ResourceCPU: resource.MustParse("200m")}}},
+			})
+		}
+		return true, &metricsv1beta1.PodMetricsList{Items: items}, nil
+	})
+	pa := &config.PodAcrobat{
+		Config:        config.Config{Policies: []string{"test-node1", "test-metrics"}},
+		Client:        fake.NewSimpleClientset(objects...),
+		MetricsClient: metricsCli,
+		DryRun:        true,
+	}
+	a, err := New(pa, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := a.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the node sample still counts a and b, evicted by the first policy
+	if seenCPU["node1"] != 100 || seenCPU["node2"] != 300 {
+		t.Errorf("expected node1 at 100m without a and b and node2 at 300m, got %v", seenCPU)
+	}
+}
+
+func TestRunDeliversEvents(t *testing.T) {
+	pod := genTestPod("a", "node1")
+	// set by the api server, events need it to refer to the pod
+	pod.SelfLink = "/api/v1/namespaces/default/pods/a"
+	cli := fake.NewSimpleClientset(genTestNode("node1"), pod)
+	var mu sync.Mutex
+	var events []*v1.Event
+	cli.PrependReactor("create", "events", func(action core.Action) (bool, runtime.Object, error) {
+		e := action.(core.CreateAction).GetObject().(*v1.Event)
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+		return true, e, nil
+	})
+	pa := &config.PodAcrobat{
+		Config: config.Config{Policies: []string{"test-node1"}},
+		Client: cli,
+	}
+	if err := Run(pa, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	// one-shot runs exit right after Run, the events must be written by then
+	mu.Lock()
+	defer mu.Unlock()
+	var delivered bool
+	for _, e := range events {
+		if e.InvolvedObject.Kind == "Pod" && e.InvolvedObject.Name == "a" && e.Reason == "Test" {
+			delivered = true
+		}
+	}
+	if !delivered {
+		t.Errorf("expected eviction event of pod a delivered, got %d events", len(events))
+	}
+}
+
+func genTestNode(name string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+}
+
+func genTestPod(name, node string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: name, UID: types.UID("uid-" + name)}},
+		},
+		Spec:   v1.PodSpec{NodeName: node},
+		Status: v1.PodStatus{Phase: v1.PodRunning},
+	}
+}
@@ -0,0 +1,59 @@
+package acrobat
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/stepdc/podacrobat/cmd/app/config"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// buildConfig resolves the client config in order: explicit --kubeconfig,
+// KUBECONFIG env, ~/.kube/config, --context and --master override what is
+// loaded. Incluster config is used only if no flag is set and no
+// kubeconfig is found.
+func buildConfig(pa *config.PodAcrobat) (*rest.Config, error) {
+	return loadConfig(pa, clientcmd.NewDefaultClientConfigLoadingRules())
+}
+
+func loadConfig(pa *config.PodAcrobat, rules *clientcmd.ClientConfigLoadingRules) (*rest.Config, error) {
+	rules.ExplicitPath = pa.Kubeconfig
+	found := kubeconfigFound(rules)
+	if !found && pa.Kubeconfig == "" && pa.Context == "" && pa.Master == "" {
+		cfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("could not generated incluster configuration for kubernetes: %v", err)
+		}
+		return cfg, nil
+	}
+	if !found && pa.Context != "" {
+		return nil, fmt.Errorf("context %q set but no kubeconfig found", pa.Context)
+	}
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: pa.Context,
+		ClusterInfo:    clientcmdapi.Cluster{Server: pa.Master},
+	}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig failed: %v", err)
+	}
+	return cfg, nil
+}
+
+// kubeconfigFound reports whether the rules point to a kubeconfig, a
+// missing explicit path is reported when loading.
+func kubeconfigFound(rules *clientcmd.ClientConfigLoadingRules) bool {
+	if rules.ExplicitPath != "" {
+		return true
+	}
+	for _, path := range rules.Precedence {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
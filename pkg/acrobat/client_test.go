@@ -0,0 +1,95 @@
+package acrobat
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stepdc/podacrobat/cmd/app/config"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: a
+  cluster:
+    server: https://a.example.com
+- name: b
+  cluster:
+    server: https://b.example.com
+users:
+- name: user
+contexts:
+- name: a
+  context:
+    cluster: a
+    user: user
+- name: b
+  context:
+    cluster: b
+    user: user
+current-context: a
+`
+
+func TestLoadConfig(t *testing.T) {
+	// the incluster case fails only outside a pod
+	for _, env := range []string{"KUBERNETES_SERVICE_HOST", "KUBERNETES_SERVICE_PORT"} {
+		if value, ok := os.LookupEnv(env); ok {
+			os.Unsetenv(env)
+			defer os.Setenv(env, value)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "podacrobat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name string
+		pa   config.PodAcrobat
+		// kubeconfig found by the default rules
+		found bool
+		host  string
+		err   string
+	}{
+		{name: "default kubeconfig", found: true, host: "https://a.example.com"},
+		{name: "default kubeconfig context", pa: config.PodAcrobat{Context: "b"}, found: true, host: "https://b.example.com"},
+		{name: "explicit kubeconfig", pa: config.PodAcrobat{Kubeconfig: path, Context: "b"}, host: "https://b.example.com"},
+		{name: "master overrides", pa: config.PodAcrobat{Master: "https://master.example.com"}, found: true, host: "https://master.example.com"},
+		{name: "unknown context", pa: config.PodAcrobat{Context: "c"}, found: true, err: "load kubeconfig failed"},
+		{name: "context without kubeconfig", pa: config.PodAcrobat{Context: "b"}, err: "no kubeconfig found"},
+		{name: "missing explicit kubeconfig", pa: config.PodAcrobat{Kubeconfig: missing}, err: "load kubeconfig failed"},
+		{name: "incluster", err: "incluster"},
+	}
+	for _, test := range tests {
+		rules := &clientcmd.ClientConfigLoadingRules{Precedence: []string{missing}}
+		if test.found {
+			rules.Precedence = []string{missing, path}
+		}
+		cfg, err := loadConfig(&test.pa, rules)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if cfg.Host != test.host {
+			t.Errorf("%s: expected host %s, got %s", test.name, test.host, cfg.Host)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package acrobat
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+)
+
+const (
+	// a one-shot run gives up on events not written by then
+	eventFlushTimeout = 30 * time.Second
+	eventWriteTries   = 3
+	eventRetryPeriod  = time.Second
+)
+
+// eventRecorder sends events to the api server, similar events are
+// aggregated as by the client-go sink. It counts the events recorded and
+// not written yet, so a one-shot run can wait for them before it exits.
+type eventRecorder struct {
+	record.EventRecorder
+	broadcaster record.EventBroadcaster
+	sink        record.EventSink
+	correlator  *record.EventCorrelator
+	pending     sync.WaitGroup
+}
+
+func newEventRecorder(cli clientset.Interface) *eventRecorder {
+	r := &eventRecorder{
+		broadcaster: record.NewBroadcaster(),
+		sink:        &corev1client.EventSinkImpl{Interface: cli.CoreV1().Events(metav1.NamespaceAll)},
+		correlator:  record.NewEventCorrelator(clock.RealClock{}),
+	}
+	r.broadcaster.StartEventWatcher(r.write)
+	r.EventRecorder = r.broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "podacrobat"})
+	return r
+}
+
+func (r *eventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.track(object)
+	r.EventRecorder.Event(object, eventtype, reason, message)
+}
+
+func (r *eventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.track(object)
+	r.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+func (r *eventRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.track(object)
+	r.EventRecorder.PastEventf(object, timestamp, eventtype, reason, messageFmt, args...)
+}
+
+func (r *eventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.track(object)
+	r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+}
+
+// track counts an event the broadcaster is going to deliver, the recorder
+// drops events it can not build a reference to the object for.
+func (r *eventRecorder) track(object runtime.Object) {
+	if _, err := reference.GetReference(scheme.Scheme, object); err == nil {
+		r.pending.Add(1)
+	}
+}
+
+// write creates the event, or patches the one it is aggregated into.
+func (r *eventRecorder) write(event *v1.Event) {
+	defer r.pending.Done()
+	eventCopy := *event
+	result, err := r.correlator.EventCorrelate(&eventCopy)
+	if err != nil {
+		log.Printf("correlate event failed: %v", err)
+	}
+	if result.Skip {
+		return
+	}
+	e := result.Event
+	for tries := 0; tries < eventWriteTries; tries++ {
+		var written *v1.Event
+		if e.Count > 1 {
+			written, err = r.sink.Patch(e, result.Patch)
+		}
+		if e.Count <= 1 || errors.IsNotFound(err) {
+			e.ResourceVersion = ""
+			written, err = r.sink.Create(e)
+		}
+		if err == nil {
+			r.correlator.UpdateState(written)
+			return
+		}
+		if _, ok := err.(*errors.StatusError); ok {
+			// rejected, retries do not help
+			break
+		}
+		time.Sleep(eventRetryPeriod)
+	}
+	log.Printf("write event %s/%s failed: %v", e.Namespace, e.Name, err)
+}
+
+// flush waits for the events recorded so far to be written, then stops the
+// broadcaster, no events may be recorded afterwards.
+func (r *eventRecorder) flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		// a late send would panic on a stopped broadcaster
+		log.Printf("events not written within %v, leave the broadcaster running", timeout)
+		return
+	}
+	// the broadcaster embeds a watch.Broadcaster, the interface of this
+	// client-go version does not expose its Shutdown
+	if b, ok := r.broadcaster.(interface{ Shutdown() }); ok {
+		b.Shutdown()
+	}
+}
@@ -0,0 +1,158 @@
+package antiaffinity
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/strategy"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const Name = "podantiaffinity"
+
+// ReasonAntiAffinityViolated is the eviction reason code of the strategy.
+const ReasonAntiAffinityViolated = "PodAntiAffinityViolated"
+
+func init() {
+	strategy.Register(strategy.Registration{
+		Name: Name,
+		New: func(strategy.Handle) (strategy.Strategy, error) {
+			return NewAntiAffinityAlgo(), nil
+		},
+	})
+}
+
+// AntiAffinityAlgo evicts pods whose required anti-affinity terms match
+// other pods in the same topology domain.
+type AntiAffinityAlgo struct{}
+
+func NewAntiAffinityAlgo() *AntiAffinityAlgo {
+	return &AntiAffinityAlgo{}
+}
+
+type placedPod struct {
+	pod  *v1.Pod
+	node *v1.Node
+}
+
+// topologyIndex groups placed pods by topology domain, indexed once per
+// topology key on first use.
+type topologyIndex struct {
+	placed  []placedPod
+	domains map[string]map[string][]placedPod
+}
+
+func newTopologyIndex(placed []placedPod) *topologyIndex {
+	return &topologyIndex{placed: placed, domains: make(map[string]map[string][]placedPod)}
+}
+
+// pods returns the placed pods on nodes with label key=value.
+func (t *topologyIndex) pods(key, value string) []placedPod {
+	domains, ok := t.domains[key]
+	if !ok {
+		domains = make(map[string][]placedPod)
+		for _, p := range t.placed {
+			if v, ok := p.node.Labels[key]; ok {
+				domains[v] = append(domains[v], p)
+			}
+		}
+		t.domains[key] = domains
+	}
+	return domains[value]
+}
+
+func (a *AntiAffinityAlgo) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	var names []string
+	for name := range nodePods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var placed []placedPod
+	for _, name := range names {
+		info := nodePods[name]
+		for _, pod := range info.Pods {
+			placed = append(placed, placedPod{pod: pod, node: info.Node})
+		}
+	}
+	index := newTopologyIndex(placed)
+
+	for _, name := range names {
+		info := nodePods[name]
+		n := rep.Node(name)
+		n.PodCount = len(info.Pods)
+		n.Classification = report.NodeNeutral
+		for _, pod := range info.Pods {
+			if pe.Done() {
+				return nil
+			}
+			if pe.IsEvicted(pod) {
+				continue
+			}
+			violation := violatedTerm(pe, pod, info.Node, index)
+			if violation == "" {
+				continue
+			}
+			n.Classification = report.NodeEvict
+			n.AddCandidates([]*v1.Pod{pod})
+			reason := resources.Reason{Code: ReasonAntiAffinityViolated, Message: violation}
+			if _, _, err := resources.EvictPods(pe, []*v1.Pod{pod}, reason, nil); err != nil {
+				return fmt.Errorf("evict pods for node %q failed: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// violatedTerm describes the first required anti-affinity term of the pod
+// matched by another pod in its topology domain, empty if none. Pods
+// evicted already do not count.
+func violatedTerm(pe *resources.PodEvictor, pod *v1.Pod, node *v1.Node, index *topologyIndex) string {
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		return ""
+	}
+	for i, term := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		domain, ok := node.Labels[term.TopologyKey]
+		if !ok {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+		if err != nil {
+			continue
+		}
+		namespaces := termNamespaces(pod, term)
+		for _, other := range index.pods(term.TopologyKey, domain) {
+			if other.pod == pod || pe.IsEvicted(other.pod) {
+				continue
+			}
+			if _, ok := namespaces[other.pod.Namespace]; !ok {
+				continue
+			}
+			if !selector.Matches(labels.Set(other.pod.Labels)) {
+				continue
+			}
+			return fmt.Sprintf("anti-affinity term %d (topologyKey %s=%s, selector %q) matches pod %s/%s on node %s",
+				i, term.TopologyKey, domain, selector.String(), other.pod.Namespace, other.pod.Name, other.node.Name)
+		}
+	}
+	return ""
+}
+
+// termNamespaces returns the namespaces of the term, the pod namespace if
+// it lists none.
+func termNamespaces(pod *v1.Pod, term v1.PodAffinityTerm) map[string]struct{} {
+	ret := make(map[string]struct{})
+	if len(term.Namespaces) == 0 {
+		ret[pod.Namespace] = struct{}{}
+		return ret
+	}
+	for _, ns := range term.Namespaces {
+		ret[ns] = struct{}{}
+	}
+	return ret
+}
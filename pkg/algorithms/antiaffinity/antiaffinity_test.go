@@ -0,0 +1,74 @@
+package antiaffinity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const zoneKey = "failure-domain.beta.kubernetes.io/zone"
+
+func TestAntiAffinity(t *testing.T) {
+	node1 := genTestNode("node1", "a")
+	node2 := genTestNode("node2", "a")
+	node3 := genTestNode("node3", "b")
+	nodePods := map[string]resources.NodeInfoWithPods{
+		// web pods repel each other by zone, both in zone a
+		node1.Name: {Node: node1, Pods: []*v1.Pod{genTestPod("web-0", node1.Name, "web", zoneKey)}},
+		node2.Name: {Node: node2, Pods: []*v1.Pod{genTestPod("web-1", node2.Name, "web", zoneKey)}},
+		// no web pod on node3
+		node3.Name: {Node: node3, Pods: []*v1.Pod{genTestPod("db-0", node3.Name, "web", "kubernetes.io/hostname")}},
+	}
+
+	pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := NewAntiAffinityAlgo().Run(pe, nodePods, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	// web-1 no longer violates its term once web-0 is evicted
+	evicted := pe.Evicted()
+	if len(evicted) != 1 || evicted[0].Pod.Name != "web-0" {
+		t.Fatalf("expected web-0 evicted, got %v", evicted)
+	}
+	if !strings.Contains(evicted[0].Reason, zoneKey) || !strings.Contains(evicted[0].Reason, "default/web-1") {
+		t.Errorf("expected violated term and pod in reason, got %q", evicted[0].Reason)
+	}
+	if c := rep.Node(node3.Name).Classification; c != report.NodeNeutral {
+		t.Errorf("node3 classified as %q, expected %q", c, report.NodeNeutral)
+	}
+}
+
+func genTestPod(name, nodeName, repel, topologyKey string) *v1.Pod {
+	app := strings.Split(name, "-")[0]
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			Labels:          map[string]string{"app": app},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: app}},
+		},
+		Spec: v1.PodSpec{
+			NodeName: nodeName,
+			Affinity: &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": repel}},
+					TopologyKey:   topologyKey,
+				}},
+			}},
+		},
+	}
+}
+
+func genTestNode(name, zone string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   name,
+		Labels: map[string]string{zoneKey: zone, "kubernetes.io/hostname": name},
+	}}
+}
@@ -6,14 +6,88 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 
-	"github.com/stepdc/podacrobat/cmd/app/config"
+	"github.com/spf13/pflag"
+	"github.com/stepdc/podacrobat/pkg/report"
 	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/strategy"
+)
+
+const Name = "podscount"
+
+// ReasonTooManyPods is the eviction reason code of the strategy.
+const ReasonTooManyPods = "TooManyPods"
+
+func init() {
+	opts := &Options{}
+	strategy.Register(strategy.Registration{
+		Name:     Name,
+		AddFlags: opts.AddFlags,
+		Validate: opts.Validate,
+		Balances: true,
+		New: func(strategy.Handle) (strategy.Strategy, error) {
+			return NewPodCountAlgo(*opts), nil
+		},
+	})
+}
+
+const (
+	// thresholds are pod counts
+	ThresholdCount = "count"
+	// thresholds are percentages of node allocatable pods
+	ThresholdPercentage = "percentage"
+)
 
-	clientset "k8s.io/client-go/kubernetes"
+const (
+	// count all pods on nodes
+	CountAll = "all"
+	// count pods that may be evicted
+	CountEvictable = "evictable"
+	// leave out pods in kube-system, DaemonSet, static and critical pods
+	CountNonSystem = "non-system"
 )
 
+type Options struct {
+	IdleCountThreshold  int
+	EvictCountThreshold int
+	// how thresholds are read, pod counts or percentages
+	ThresholdMode string
+	// which pods are counted
+	Count string
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&o.IdleCountThreshold, "lowerthreshold", 30, "lower threshold")
+	fs.IntVar(&o.EvictCountThreshold, "upperthreshold", 50, "upper threshold")
+	fs.StringVar(&o.ThresholdMode, "podscount-threshold-mode", ThresholdCount,
+		fmt.Sprintf("how lower and upper thresholds are read, one of: %s(pods), %s(percentages of node allocatable pods)", ThresholdCount, ThresholdPercentage))
+	fs.StringVar(&o.Count, "podscount-pods", CountAll,
+		fmt.Sprintf("which pods are counted, one of: %s, %s, %s(leave out kube-system, DaemonSet, static and critical pods)", CountAll, CountEvictable, CountNonSystem))
+}
+
+func (o *Options) Validate() error {
+	if o.IdleCountThreshold > o.EvictCountThreshold {
+		return fmt.Errorf("lowerthreshold %d greater than upperthreshold %d", o.IdleCountThreshold, o.EvictCountThreshold)
+	}
+	switch o.ThresholdMode {
+	case ThresholdCount, "":
+	case ThresholdPercentage:
+		if o.IdleCountThreshold < 0 || o.EvictCountThreshold > 100 {
+			return fmt.Errorf("illegal percentages, lowerthreshold %d, upperthreshold %d", o.IdleCountThreshold, o.EvictCountThreshold)
+		}
+	default:
+		return fmt.Errorf("unsupported podscount threshold mode %q", o.ThresholdMode)
+	}
+	switch o.Count {
+	case CountAll, CountEvictable, CountNonSystem, "":
+	default:
+		return fmt.Errorf("unsupported podscount pods %q", o.Count)
+	}
+	return nil
+}
+
 type countOptions struct {
 	lower, upper int
+	mode, count  string
 }
 
 // simple algo for test
@@ -21,35 +95,86 @@ type PodCountAlgo struct {
 	option countOptions
 }
 
-func NewPodCountAlgo(cfg config.Config) *PodCountAlgo {
+func NewPodCountAlgo(opt Options) *PodCountAlgo {
 	return &PodCountAlgo{
 		option: countOptions{
-			lower: cfg.IdleCountThreshold,
-			upper: cfg.EvictCountThreshold,
+			lower: opt.IdleCountThreshold,
+			upper: opt.EvictCountThreshold,
+			mode:  opt.ThresholdMode,
+			count: opt.Count,
 		},
 	}
 }
 
-func (pac *PodCountAlgo) Run(cli clientset.Interface, nodePods map[string]resources.NodeInfoWithPods) error {
-	needRun := pac.NeedReschedule(nodePods)
+func (pac *PodCountAlgo) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	lower, load := pac.ClassifyNodes(pe, nodePods)
+	pac.reportNodes(pe, rep, nodePods, lower, load)
+	needRun := pac.NeedReschedule(pe, nodePods)
 	if !needRun {
 		log.Println("cluster is balanced")
 		return nil
 	}
-	lower, load := pac.ClassifyNodes(nodePods)
-	return pac.Evict(cli, lower, load)
+	return pac.Evict(pe, lower, load, rep)
 }
 
-func (pac *PodCountAlgo) NeedReschedule(nodePods map[string]resources.NodeInfoWithPods) bool {
+func (pac *PodCountAlgo) reportNodes(pe *resources.PodEvictor, rep *report.StrategyReport, nodePods, idleNodes, evictNodes map[string]resources.NodeInfoWithPods) {
+	for nodeName, info := range nodePods {
+		n := rep.Node(nodeName)
+		n.PodCount = len(pac.countedPods(pe, info.Pods))
+		if _, ok := idleNodes[nodeName]; ok {
+			n.Classification = report.NodeIdle
+		}
+		if _, ok := evictNodes[nodeName]; ok {
+			n.Classification = report.NodeEvict
+		}
+	}
+}
+
+// countedPods returns the pods counted against the thresholds.
+func (pac *PodCountAlgo) countedPods(pe *resources.PodEvictor, pods []*v1.Pod) []*v1.Pod {
+	switch pac.option.count {
+	case CountEvictable:
+		return pe.FilterEvictablePods(pods)
+	case CountNonSystem:
+		var ret []*v1.Pod
+		for _, pod := range pods {
+			if !resources.IsSystemPod(pod) {
+				ret = append(ret, pod)
+			}
+		}
+		return ret
+	}
+	return pods
+}
+
+// thresholds returns the lower and upper thresholds of the node in pods,
+// false if percentages apply and the node has no allocatable pods.
+func (pac *PodCountAlgo) thresholds(node *v1.Node) (int, int, bool) {
+	if pac.option.mode != ThresholdPercentage {
+		return pac.option.lower, pac.option.upper, true
+	}
+	pods := node.Status.Allocatable.Pods().Value()
+	if pods <= 0 {
+		return 0, 0, false
+	}
+	return int(int64(pac.option.lower) * pods / 100), int(int64(pac.option.upper) * pods / 100), true
+}
+
+func (pac *PodCountAlgo) NeedReschedule(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods) bool {
 	if len(nodePods) <= 1 {
 		return false
 	}
 	var lmatched, umatched bool
 	for _, node := range nodePods {
-		if len(node.Pods) <= pac.option.lower {
+		lower, upper, ok := pac.thresholds(node.Node)
+		if !ok {
+			continue
+		}
+		count := len(pac.countedPods(pe, node.Pods))
+		if count <= lower {
 			lmatched = true
 		}
-		if len(node.Pods) >= pac.option.upper {
+		if count >= upper {
 			umatched = true
 		}
 
@@ -61,7 +186,7 @@ func (pac *PodCountAlgo) NeedReschedule(nodePods map[string]resources.NodeInfoWi
 	return false
 }
 
-func (pac *PodCountAlgo) ClassifyNodes(nodePods map[string]resources.NodeInfoWithPods) (map[string]resources.NodeInfoWithPods, map[string]resources.NodeInfoWithPods) {
+func (pac *PodCountAlgo) ClassifyNodes(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods) (map[string]resources.NodeInfoWithPods, map[string]resources.NodeInfoWithPods) {
 	idleNodes := make(map[string]resources.NodeInfoWithPods)
 	evictNodes := make(map[string]resources.NodeInfoWithPods)
 
@@ -69,10 +194,15 @@ func (pac *PodCountAlgo) ClassifyNodes(nodePods map[string]resources.NodeInfoWit
 		if info.Node.Spec.Unschedulable {
 			continue
 		}
-		if len(info.Pods) <= pac.option.lower {
+		lower, upper, ok := pac.thresholds(info.Node)
+		if !ok {
+			continue
+		}
+		count := len(pac.countedPods(pe, info.Pods))
+		if count <= lower {
 			idleNodes[nodeName] = info
 		}
-		if len(info.Pods) >= pac.option.upper {
+		if count >= upper {
 			evictNodes[nodeName] = info
 		}
 	}
@@ -80,9 +210,9 @@ func (pac *PodCountAlgo) ClassifyNodes(nodePods map[string]resources.NodeInfoWit
 	return idleNodes, evictNodes
 }
 
-func (pac *PodCountAlgo) Evict(cli clientset.Interface, idleNodes, evictNodes map[string]resources.NodeInfoWithPods) error {
-	total := totalPodCapacity(idleNodes, pac.option.lower)
-	shouldEvictTotal := mostEvictCount(evictNodes, pac.option.upper)
+func (pac *PodCountAlgo) Evict(pe *resources.PodEvictor, idleNodes, evictNodes map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	total := pac.totalPodCapacity(pe, idleNodes)
+	shouldEvictTotal := pac.mostEvictCount(pe, evictNodes)
 
 	var refsSet map[string]struct{}
 	// evict BestEffort & Burstable pods only
@@ -90,10 +220,19 @@ func (pac *PodCountAlgo) Evict(cli clientset.Interface, idleNodes, evictNodes ma
 		if total <= 0 || shouldEvictTotal <= 0 {
 			return nil
 		}
-		bePods := info.BestEffortPods()
+		_, upper, _ := pac.thresholds(info.Node)
+		reason := resources.Reason{
+			Code:    ReasonTooManyPods,
+			Message: fmt.Sprintf("node has %d %s pods, upper threshold %d", len(pac.countedPods(pe, info.Pods)), pac.countName(), upper),
+		}
+		// no node is drained below its upper threshold, and only counted
+		// pods lower the count
+		nodeExcess := pac.evictCount(pe, info)
+		bePods := pac.countedPods(pe, info.BestEffortPods())
+		rep.Node(info.Node.Name).AddCandidates(bePods)
 		var evictedBePods []*v1.Pod
 		var err error
-		evictedBePods, refsSet, err = resources.EvictPods(cli, bePods, refsSet)
+		evictedBePods, refsSet, err = evictPods(pe, bePods, reason, refsSet, minInt(nodeExcess, minInt(total, shouldEvictTotal)))
 		if err != nil {
 			err = fmt.Errorf("evict pods failed: %v", err)
 			log.Print(err)
@@ -102,13 +241,18 @@ func (pac *PodCountAlgo) Evict(cli clientset.Interface, idleNodes, evictNodes ma
 		log.Printf("evict %v BestEffort level for node %v", len(evictedBePods), info.Node.Name)
 		total -= len(evictedBePods)
 		shouldEvictTotal -= len(evictedBePods)
+		nodeExcess -= len(evictedBePods)
 
 		if total <= 0 || shouldEvictTotal <= 0 {
 			return nil
 		}
-		buPods := info.BurstablePods()
+		if nodeExcess <= 0 {
+			continue
+		}
+		buPods := pac.countedPods(pe, info.BurstablePods())
+		rep.Node(info.Node.Name).AddCandidates(buPods)
 		var evictedBuPods []*v1.Pod
-		evictedBuPods, refsSet, err = resources.EvictPods(cli, buPods, nil)
+		evictedBuPods, refsSet, err = evictPods(pe, buPods, reason, refsSet, minInt(nodeExcess, minInt(total, shouldEvictTotal)))
 		if err != nil {
 			err = fmt.Errorf("evict pods failed: %v", err)
 			log.Print(err)
@@ -122,10 +266,42 @@ func (pac *PodCountAlgo) Evict(cli clientset.Interface, idleNodes, evictNodes ma
 	return nil
 }
 
-func totalPodCapacity(nodePods map[string]resources.NodeInfoWithPods, threshold int) int {
+func (pac *PodCountAlgo) countName() string {
+	if pac.option.count == "" {
+		return CountAll
+	}
+	return pac.option.count
+}
+
+// evictPods evicts pods in order until limit of them are evicted.
+func evictPods(pe *resources.PodEvictor, pods []*v1.Pod, reason resources.Reason, refsSet map[string]struct{}, limit int) ([]*v1.Pod, map[string]struct{}, error) {
+	var evicted []*v1.Pod
+	for _, pod := range pods {
+		if len(evicted) >= limit {
+			break
+		}
+		podEvicted, refs, err := resources.EvictPods(pe, []*v1.Pod{pod}, reason, refsSet)
+		if err != nil {
+			return evicted, refs, err
+		}
+		refsSet = refs
+		evicted = append(evicted, podEvicted...)
+	}
+	return evicted, refsSet, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (pac *PodCountAlgo) totalPodCapacity(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods) int {
 	var ret int
 	for _, node := range nodePods {
-		c := threshold - len(node.Pods)
+		lower, _, _ := pac.thresholds(node.Node)
+		c := lower - len(pac.countedPods(pe, node.Pods))
 		if c > 0 {
 			ret += c
 		}
@@ -134,14 +310,26 @@ func totalPodCapacity(nodePods map[string]resources.NodeInfoWithPods, threshold
 	return ret
 }
 
-func mostEvictCount(nodePods map[string]resources.NodeInfoWithPods, threshold int) int {
+// mostEvictCount counts the pods above the upper thresholds, at most the
+// evictable ones.
+func (pac *PodCountAlgo) mostEvictCount(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods) int {
 	var ret int
 	for _, node := range nodePods {
-		pods := resources.FilterEvictablePods(node.Pods)
-		c := len(pods) - threshold
-		if c > 0 {
-			ret += c
-		}
+		ret += pac.evictCount(pe, node)
 	}
 	return ret
 }
+
+// evictCount returns the counted evictable pods of the node above its
+// upper threshold.
+func (pac *PodCountAlgo) evictCount(pe *resources.PodEvictor, node resources.NodeInfoWithPods) int {
+	_, upper, _ := pac.thresholds(node.Node)
+	c := len(pac.countedPods(pe, node.Pods)) - upper
+	if evictable := len(pac.countedPods(pe, pe.FilterEvictablePods(node.Pods))); c > evictable {
+		c = evictable
+	}
+	if c < 0 {
+		return 0
+	}
+	return c
+}
@@ -0,0 +1,167 @@
+package count
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodCountPercentage(t *testing.T) {
+	// a big node with 12 of 100 pods and a small one with 8 of 10 pods,
+	// 4 of them DaemonSet pods
+	big := genTestNode("big", 100)
+	small := genTestNode("small", 10)
+	var bigPods, smallPods []*v1.Pod
+	for i := 0; i < 12; i++ {
+		bigPods = append(bigPods, genTestPod(fmt.Sprintf("big-%d", i), big.Name, "ReplicaSet"))
+	}
+	for i := 0; i < 8; i++ {
+		kind := "ReplicaSet"
+		if i < 4 {
+			kind = "DaemonSet"
+		}
+		smallPods = append(smallPods, genTestPod(fmt.Sprintf("small-%d", i), small.Name, kind))
+	}
+	nodePods := map[string]resources.NodeInfoWithPods{
+		big.Name:   {Node: big, Pods: bigPods},
+		small.Name: {Node: small, Pods: smallPods},
+	}
+
+	tests := []struct {
+		opts  Options
+		evict bool
+	}{
+		// raw counts see the big node as loaded, with no room on the small one
+		{opts: Options{IdleCountThreshold: 8, EvictCountThreshold: 10, ThresholdMode: ThresholdCount, Count: CountAll}},
+		// 80% of the small node is used
+		{opts: Options{IdleCountThreshold: 20, EvictCountThreshold: 50, ThresholdMode: ThresholdPercentage, Count: CountAll}, evict: true},
+		// 40% without DaemonSet pods
+		{opts: Options{IdleCountThreshold: 20, EvictCountThreshold: 50, ThresholdMode: ThresholdPercentage, Count: CountNonSystem}},
+	}
+	for i, test := range tests {
+		if err := test.opts.Validate(); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+		rep := report.New([]string{Name}, true).Strategy(Name)
+		if err := NewPodCountAlgo(test.opts).Run(pe, nodePods, rep); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if evicted := len(pe.Evicted()) > 0; evicted != test.evict {
+			t.Errorf("case %d: expected eviction %v, got %d pods evicted", i, test.evict, len(pe.Evicted()))
+		}
+		for _, e := range pe.Evicted() {
+			if e.Node != small.Name {
+				t.Errorf("case %d: pod %q evicted from %q, expected %q", i, e.Pod.Name, e.Node, small.Name)
+			}
+		}
+	}
+
+	if err := (&Options{IdleCountThreshold: 20, EvictCountThreshold: 150, ThresholdMode: ThresholdPercentage}).Validate(); err == nil {
+		t.Errorf("expected percentage above 100 rejected")
+	}
+}
+
+func TestPodCountEvictBudget(t *testing.T) {
+	// the small node has 8 of 10 pods, 3 above the 50% threshold
+	big := genTestNode("big", 100)
+	small := genTestNode("small", 10)
+	var smallPods []*v1.Pod
+	for i := 0; i < 8; i++ {
+		pod := genTestPod(fmt.Sprintf("small-%d", i), small.Name, "ReplicaSet")
+		if i > 0 {
+			pod.Spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")}
+		}
+		smallPods = append(smallPods, pod)
+	}
+	// the first Burstable pod shares the owner of the BestEffort one
+	smallPods[1].OwnerReferences[0].UID = smallPods[0].OwnerReferences[0].UID
+	nodePods := map[string]resources.NodeInfoWithPods{
+		big.Name:   {Node: big},
+		small.Name: {Node: small, Pods: smallPods},
+	}
+
+	opts := Options{IdleCountThreshold: 20, EvictCountThreshold: 50, ThresholdMode: ThresholdPercentage, Count: CountAll}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := NewPodCountAlgo(opts).Run(pe, nodePods, rep); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pe.Evicted()); n != 3 {
+		t.Errorf("expected 3 pods evicted, got %d", n)
+	}
+	for _, e := range pe.Evicted() {
+		if e.Pod.Name == smallPods[1].Name {
+			t.Errorf("expected pod %q skipped, its owner is evicted", e.Pod.Name)
+		}
+	}
+}
+
+func TestPodCountEvictPerNode(t *testing.T) {
+	// one is 1 pod above the upper threshold of 5, three 3 pods, the
+	// kube-system pods are not counted
+	nodePods := map[string]resources.NodeInfoWithPods{"big": {Node: genTestNode("big", 100)}}
+	for name, count := range map[string]int{"one": 6, "three": 8} {
+		var pods []*v1.Pod
+		for i := 0; i < 3; i++ {
+			pod := genTestPod(fmt.Sprintf("%s-system-%d", name, i), name, "ReplicaSet")
+			pod.Namespace = metav1.NamespaceSystem
+			pods = append(pods, pod)
+		}
+		for i := 0; i < count; i++ {
+			pods = append(pods, genTestPod(fmt.Sprintf("%s-%d", name, i), name, "ReplicaSet"))
+		}
+		nodePods[name] = resources.NodeInfoWithPods{Node: genTestNode(name, 10), Pods: pods}
+	}
+
+	opts := Options{IdleCountThreshold: 20, EvictCountThreshold: 50, ThresholdMode: ThresholdPercentage, Count: CountNonSystem}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := NewPodCountAlgo(opts).Run(pe, nodePods, rep); err != nil {
+		t.Fatal(err)
+	}
+	evicted := make(map[string]int)
+	for _, e := range pe.Evicted() {
+		evicted[e.Node]++
+		if e.Pod.Namespace == metav1.NamespaceSystem {
+			t.Errorf("expected not counted pod %s/%s kept", e.Pod.Namespace, e.Pod.Name)
+		}
+	}
+	if evicted["one"] != 1 || evicted["three"] != 3 {
+		t.Errorf("expected 1 pod evicted from one and 3 from three, got %v", evicted)
+	}
+}
+
+func genTestPod(name, nodeName, ownerKind string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			OwnerReferences: []metav1.OwnerReference{{Kind: ownerKind, Name: name, UID: types.UID(name)}},
+		},
+		Spec: v1.PodSpec{NodeName: nodeName, Containers: []v1.Container{{Name: "app"}}},
+	}
+}
+
+func genTestNode(name string, pods int64) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{v1.ResourcePods: *resource.NewQuantity(pods, resource.DecimalSI)},
+		},
+	}
+}
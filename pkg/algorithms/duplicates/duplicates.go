@@ -0,0 +1,156 @@
+package duplicates
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/simulator"
+	"github.com/stepdc/podacrobat/pkg/strategy"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const Name = "duplicates"
+
+// ReasonDuplicatePod is the eviction reason code of the strategy.
+const ReasonDuplicatePod = "DuplicatePod"
+
+// owners whose replicas are spread
+var ownerKinds = map[string]struct{}{
+	"ReplicaSet":            {},
+	"StatefulSet":           {},
+	"Job":                   {},
+	"ReplicationController": {},
+}
+
+func init() {
+	strategy.Register(strategy.Registration{
+		Name: Name,
+		New: func(strategy.Handle) (strategy.Strategy, error) {
+			return NewDuplicatesAlgo(), nil
+		},
+	})
+}
+
+// DuplicatesAlgo keeps one pod per owner and container images on a node,
+// extras are evicted if another node could take them.
+type DuplicatesAlgo struct{}
+
+func NewDuplicatesAlgo() *DuplicatesAlgo {
+	return &DuplicatesAlgo{}
+}
+
+func (d *DuplicatesAlgo) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	// duplicate keys on every node, to find nodes without the duplicate
+	keys := make(map[string]map[string][]*v1.Pod)
+	for nodeName, info := range nodePods {
+		keys[nodeName] = groupByKey(info.Pods)
+	}
+	// reserves the capacity and host ports of moved extras on their destination
+	placer := simulator.New(nodePods, nil)
+
+	for _, nodeName := range sortedNames(nodePods) {
+		info := nodePods[nodeName]
+		n := rep.Node(nodeName)
+		n.PodCount = len(info.Pods)
+		n.Classification = report.NodeNeutral
+
+		groups := keys[nodeName]
+		var groupKeys []string
+		for key, pods := range groups {
+			if len(pods) > 1 {
+				groupKeys = append(groupKeys, key)
+			}
+		}
+		sort.Strings(groupKeys)
+		for _, key := range groupKeys {
+			pods := groups[key]
+			n.Classification = report.NodeEvict
+			// keep the first pod
+			extras := pods[1:]
+			n.AddCandidates(extras)
+			for _, pod := range extras {
+				if pe.Done() {
+					return nil
+				}
+				// not evictable pods are reported as such, not as without destination
+				if pe.IsEvicted(pod) {
+					continue
+				}
+				if skip, ok := pe.NotEvictable(pod); ok {
+					pe.Skip(pod, skip)
+					continue
+				}
+				dest, skip := placer.PlaceExcept(pod, func(node string) string {
+					if len(keys[node][key]) > 0 {
+						return "runs a duplicate"
+					}
+					return ""
+				})
+				if dest == "" {
+					pe.Skip(pod, resources.Reason{Code: resources.ReasonNoDestination, Message: skip})
+					continue
+				}
+				reason := resources.Reason{
+					Code:    ReasonDuplicatePod,
+					Message: fmt.Sprintf("%d pods of %s on node %s, node %s has none", len(pods), key, nodeName, dest),
+				}
+				evicted, _, err := resources.EvictPods(pe, []*v1.Pod{pod}, reason, nil)
+				if err != nil {
+					return fmt.Errorf("evict pods for node %q failed: %v", nodeName, err)
+				}
+				// spread the next extras to other nodes
+				if len(evicted) == 0 {
+					placer.Unreserve(pod, dest)
+					continue
+				}
+				keys[dest][key] = append(keys[dest][key], pod)
+			}
+		}
+	}
+	return nil
+}
+
+// groupByKey groups pods with an owner of the kinds spread by owner and
+// container images.
+func groupByKey(pods []*v1.Pod) map[string][]*v1.Pod {
+	ret := make(map[string][]*v1.Pod)
+	for _, pod := range pods {
+		key := duplicateKey(pod)
+		if key == "" {
+			continue
+		}
+		ret[key] = append(ret[key], pod)
+	}
+	for _, pods := range ret {
+		sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	}
+	return ret
+}
+
+func duplicateKey(pod *v1.Pod) string {
+	for _, ref := range pod.OwnerReferences {
+		if _, ok := ownerKinds[ref.Kind]; !ok {
+			continue
+		}
+		var images []string
+		for _, c := range pod.Spec.Containers {
+			images = append(images, c.Image)
+		}
+		sort.Strings(images)
+		return fmt.Sprintf("%s %s/%s with images [%s]", ref.Kind, pod.Namespace, ref.Name, strings.Join(images, ","))
+	}
+	return ""
+}
+
+func sortedNames(nodePods map[string]resources.NodeInfoWithPods) []string {
+	var names []string
+	for name := range nodePods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
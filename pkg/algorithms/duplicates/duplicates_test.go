@@ -0,0 +1,132 @@
+package duplicates
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDuplicates(t *testing.T) {
+	nodePods := map[string]resources.NodeInfoWithPods{
+		"node1": {Node: genTestNode("node1"), Pods: []*v1.Pod{
+			genTestPod("web-0", "node1", "web", "nginx:1"),
+			genTestPod("web-1", "node1", "web", "nginx:1"),
+			genTestPod("web-2", "node1", "web", "nginx:1"),
+			// rolling out a new image, not a duplicate
+			genTestPod("web-3", "node1", "web", "nginx:2"),
+			genTestPod("db-0", "node1", "db", "mysql"),
+		}},
+		"node2": {Node: genTestNode("node2"), Pods: []*v1.Pod{
+			genTestPod("web-4", "node2", "web", "nginx:1"),
+		}},
+		"node3": {Node: genTestNode("node3")},
+	}
+
+	pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := NewDuplicatesAlgo().Run(pe, nodePods, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	// web-1 moves to node3, no node is left for web-2
+	evicted := pe.Evicted()
+	if len(evicted) != 1 || evicted[0].Pod.Name != "web-1" {
+		t.Fatalf("expected web-1 evicted, got %v", evicted)
+	}
+	skipped := pe.Skipped()
+	if len(skipped) != 1 || skipped[0].Pod.Name != "web-2" || skipped[0].Code != resources.ReasonNoDestination {
+		t.Errorf("expected web-2 skipped without destination, got %v", skipped)
+	}
+	if c := rep.Node("node1").Classification; c != report.NodeEvict {
+		t.Errorf("node1 classified as %q, expected %q", c, report.NodeEvict)
+	}
+	if c := rep.Node("node2").Classification; c != report.NodeNeutral {
+		t.Errorf("node2 classified as %q, expected %q", c, report.NodeNeutral)
+	}
+}
+
+func TestDuplicatesNotEvictable(t *testing.T) {
+	local := genTestPod("web-1", "node1", "web", "nginx:1")
+	local.Spec.Volumes = []v1.Volume{{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+	// no node without a duplicate
+	nodePods := map[string]resources.NodeInfoWithPods{
+		"node1": {Node: genTestNode("node1"), Pods: []*v1.Pod{
+			genTestPod("web-0", "node1", "web", "nginx:1"),
+			local,
+			genTestPod("web-2", "node1", "web", "nginx:1"),
+		}},
+	}
+
+	pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := NewDuplicatesAlgo().Run(pe, nodePods, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	skipped := make(map[string]string)
+	for _, s := range pe.Skipped() {
+		skipped[s.Pod.Name] = s.Code
+	}
+	if skipped["web-1"] != resources.ReasonNotEvictable || skipped["web-2"] != resources.ReasonNoDestination {
+		t.Errorf("expected web-1 skipped as not evictable and web-2 without destination, got %v", skipped)
+	}
+}
+
+func TestDuplicatesCapacity(t *testing.T) {
+	withCPU := func(pod *v1.Pod) *v1.Pod {
+		pod.Spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceCPU: resource.MustParse("400m")}
+		return pod
+	}
+	node2 := genTestNode("node2")
+	node2.Status.Allocatable = v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}
+	nodePods := map[string]resources.NodeInfoWithPods{
+		"node1": {Node: genTestNode("node1"), Pods: []*v1.Pod{
+			withCPU(genTestPod("api-0", "node1", "api", "api")),
+			withCPU(genTestPod("api-1", "node1", "api", "api")),
+			withCPU(genTestPod("web-0", "node1", "web", "nginx")),
+			withCPU(genTestPod("web-1", "node1", "web", "nginx")),
+		}},
+		"node2": {Node: node2},
+	}
+
+	pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := NewDuplicatesAlgo().Run(pe, nodePods, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	// api-1 takes the free cpu of node2, web-1 does not fit anymore
+	evicted := pe.Evicted()
+	if len(evicted) != 1 || evicted[0].Pod.Name != "api-1" {
+		t.Fatalf("expected api-1 evicted, got %v", evicted)
+	}
+	skipped := pe.Skipped()
+	if len(skipped) != 1 || skipped[0].Pod.Name != "web-1" || !strings.Contains(skipped[0].Reason, "insufficient cpu") {
+		t.Errorf("expected web-1 skipped for insufficient cpu, got %v", skipped)
+	}
+}
+
+func genTestPod(name, nodeName, owner, image string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner}},
+		},
+		Spec: v1.PodSpec{
+			NodeName:   nodeName,
+			Containers: []v1.Container{{Name: "app", Image: image}},
+		},
+	}
+}
+
+func genTestNode(name string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
@@ -0,0 +1,92 @@
+package nodeaffinity
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/strategy"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const Name = "nodeaffinity"
+
+// ReasonNodeAffinityViolated is the eviction reason code of the strategy.
+const ReasonNodeAffinityViolated = "NodeAffinityViolated"
+
+func init() {
+	strategy.Register(strategy.Registration{
+		Name: Name,
+		New: func(strategy.Handle) (strategy.Strategy, error) {
+			return NewNodeAffinityAlgo(), nil
+		},
+	})
+}
+
+// NodeAffinityAlgo evicts pods whose node no longer matches their node
+// selector or required node affinity, if another node does.
+type NodeAffinityAlgo struct{}
+
+func NewNodeAffinityAlgo() *NodeAffinityAlgo {
+	return &NodeAffinityAlgo{}
+}
+
+func (a *NodeAffinityAlgo) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	var names []string
+	for name := range nodePods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		info := nodePods[name]
+		n := rep.Node(name)
+		n.PodCount = len(info.Pods)
+		n.Classification = report.NodeNeutral
+		for _, pod := range info.Pods {
+			if pe.Done() {
+				return nil
+			}
+			if pe.IsEvicted(pod) || resources.PodMatchesNodeSelectorAndAffinity(pod, info.Node) {
+				continue
+			}
+			// not evictable pods are reported as such, not as without destination
+			if skip, ok := pe.NotEvictable(pod); ok {
+				pe.Skip(pod, skip)
+				continue
+			}
+			n.Classification = report.NodeEvict
+			n.AddCandidates([]*v1.Pod{pod})
+			dest := destination(pod, names, nodePods)
+			if dest == "" {
+				pe.Skip(pod, resources.Reason{Code: resources.ReasonNoDestination, Message: "no other ready node matches node selector or affinity"})
+				continue
+			}
+			reason := resources.Reason{
+				Code:    ReasonNodeAffinityViolated,
+				Message: fmt.Sprintf("node %s does not match node selector or required node affinity any more, node %s does", name, dest),
+			}
+			if _, _, err := resources.EvictPods(pe, []*v1.Pod{pod}, reason, nil); err != nil {
+				return fmt.Errorf("evict pods for node %q failed: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// destination returns another ready and schedulable node matching node
+// selector, affinity and taints of the pod.
+func destination(pod *v1.Pod, names []string, nodePods map[string]resources.NodeInfoWithPods) string {
+	for _, name := range names {
+		node := nodePods[name].Node
+		if name == pod.Spec.NodeName || node.Spec.Unschedulable || !resources.IsNodeReady(node) {
+			continue
+		}
+		if resources.PodMatchesNodeSelectorAndAffinity(pod, node) && resources.PodToleratesNodeTaints(pod, node) {
+			return name
+		}
+	}
+	return ""
+}
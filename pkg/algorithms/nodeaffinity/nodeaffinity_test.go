@@ -0,0 +1,88 @@
+package nodeaffinity
+
+import (
+	"testing"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeAffinity(t *testing.T) {
+	// node1 lost its ssd label, node2 has it but is not ready
+	node1 := genTestNode("node1", nil, true)
+	node2 := genTestNode("node2", map[string]string{"disk": "ssd"}, false)
+	node3 := genTestNode("node3", map[string]string{"gpu": "true"}, true)
+
+	ssd := genTestPod("ssd-0", node1.Name)
+	ssd.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+	gpu := genTestPod("gpu-0", node1.Name)
+	gpu.Spec.Affinity = &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+			MatchExpressions: []v1.NodeSelectorRequirement{{Key: "gpu", Operator: v1.NodeSelectorOpExists}},
+		}}},
+	}}
+	plain := genTestPod("plain-0", node1.Name)
+	// not evictable, whether it has a destination or not
+	local := genTestPod("local-0", node1.Name)
+	local.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+	local.Spec.Volumes = []v1.Volume{{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+	nodePods := map[string]resources.NodeInfoWithPods{
+		node1.Name: {Node: node1, Pods: []*v1.Pod{ssd, gpu, plain, local}},
+		node2.Name: {Node: node2},
+		node3.Name: {Node: node3},
+	}
+
+	pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := NewNodeAffinityAlgo().Run(pe, nodePods, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	evicted := pe.Evicted()
+	if len(evicted) != 1 || evicted[0].Pod.Name != gpu.Name || evicted[0].Code != ReasonNodeAffinityViolated {
+		t.Fatalf("expected %s evicted, got %v", gpu.Name, evicted)
+	}
+	skipped := pe.Skipped()
+	if len(skipped) != 2 || skipped[0].Pod.Name != ssd.Name || skipped[0].Code != resources.ReasonNoDestination {
+		t.Errorf("expected %s skipped without a ready destination, got %v", ssd.Name, skipped)
+	}
+	if len(skipped) == 2 && (skipped[1].Pod.Name != local.Name || skipped[1].Code != resources.ReasonNotEvictable) {
+		t.Errorf("expected %s skipped as not evictable, got %s skipped by %s", local.Name, skipped[1].Pod.Name, skipped[1].Code)
+	}
+	for _, c := range rep.Node(node1.Name).Candidates {
+		if c == local.Namespace+"/"+local.Name {
+			t.Errorf("expected %s not listed as candidate", local.Name)
+		}
+	}
+	if c := rep.Node(node1.Name).Classification; c != report.NodeEvict {
+		t.Errorf("node1 classified as %q, expected %q", c, report.NodeEvict)
+	}
+}
+
+func genTestPod(name, nodeName string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: name}},
+		},
+		Spec: v1.PodSpec{NodeName: nodeName},
+	}
+}
+
+func genTestNode(name string, labels map[string]string, ready bool) *v1.Node {
+	status := v1.ConditionTrue
+	if !ready {
+		status = v1.ConditionFalse
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}},
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// thresholds are percentages of node resources
+	ThresholdAbsolute = "absolute"
+	// idle/evict thresholds are standard deviations below/above the mean
+	// usage of nodes
+	ThresholdStdDev = "stddev"
+	// idle/evict thresholds are percentage points below/above the mean
+	// usage of nodes
+	ThresholdPoints = "points"
+)
+
+var ErrIllegalUtil = errors.New("illegal util percentage")
+
+func validateThreshold(mode string, t Threshold) error {
+	switch mode {
+	case ThresholdAbsolute, "":
+		if err := validateUtilPercentage(t.Evict); err != nil {
+			return err
+		}
+		if err := validateUtilPercentage(t.Idle); err != nil {
+			return err
+		}
+		return lessThan(t.Idle, t.Evict)
+	case ThresholdStdDev:
+		if t.Idle < 0 || t.Evict < 0 {
+			return fmt.Errorf("illegal standard deviations %v:%v", t.Idle, t.Evict)
+		}
+		return nil
+	case ThresholdPoints:
+		if err := validateUtilPercentage(t.Evict); err != nil {
+			return err
+		}
+		return validateUtilPercentage(t.Idle)
+	}
+	return fmt.Errorf("unsupported util threshold mode %q", mode)
+}
+
+func validateUtilPercentage(f float64) error {
+	if f < 0 || f > 100 {
+		return ErrIllegalUtil
+	}
+
+	return nil
+}
+
+func lessThan(f1, f2 float64) error {
+	if f1 > f2 {
+		return fmt.Errorf("parameter not matched")
+	}
+	return nil
+}
+
+// Thresholds returns the absolute thresholds of this run, deviation based
+// thresholds are computed from the usage of schedulable nodes.
+func (cmu *CpuMemUtilAlgo) Thresholds(nodePods map[string]resources.NodeInfoWithPods) map[v1.ResourceName]Threshold {
+	if cmu.mode == ThresholdAbsolute || cmu.mode == "" {
+		return cmu.thresholds
+	}
+
+	ret := make(map[v1.ResourceName]Threshold, len(cmu.thresholds))
+	for name, t := range cmu.thresholds {
+		var percentages []float64
+		for _, info := range nodePods {
+			if info.Node.Spec.Unschedulable {
+				continue
+			}
+			capacity := resources.NodeResources(info.Node, cmu.basis)
+			if _, ok := capacity[name]; !ok {
+				continue
+			}
+			percentages = append(percentages, resources.ResourceUsagePercentage(name, cmu.usage.NodeUsage(info), capacity))
+		}
+		mean, stddev := meanStdDev(percentages)
+		below, above := t.Idle, t.Evict
+		if cmu.mode == ThresholdStdDev {
+			below, above = t.Idle*stddev, t.Evict*stddev
+		}
+		ret[name] = Threshold{Idle: clampPercentage(mean - below), Evict: clampPercentage(mean + above)}
+		log.Printf("%s usage mean %.2f%%, stddev %.2f, idle threshold %.2f%%, evict threshold %.2f%%",
+			name, mean, stddev, ret[name].Idle, ret[name].Evict)
+	}
+	return ret
+}
+
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+func clampPercentage(f float64) float64 {
+	return math.Max(0, math.Min(100, f))
+}
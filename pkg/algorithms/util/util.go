@@ -3,98 +3,314 @@ package util
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/stepdc/podacrobat/cmd/app/config"
+	"github.com/spf13/pflag"
+	"github.com/stepdc/podacrobat/pkg/report"
 	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/simulator"
+	"github.com/stepdc/podacrobat/pkg/strategy"
+	"github.com/stepdc/podacrobat/pkg/usage"
 
 	v1 "k8s.io/api/core/v1"
-	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
-type cmuOption struct {
-	cpuEvictThreshold, cpuIdleThreshold float64
-	memEvictThreshold, memIdleThreshold float64
+const Name = "nodesutil"
+
+// ReasonNodeOverutilized is the eviction reason code of the strategy.
+const ReasonNodeOverutilized = "NodeOverutilized"
+
+// which evict thresholds a node must reach to be evicted
+const (
+	EvictMatchAll = "all"
+	EvictMatchAny = "any"
+)
+
+func init() {
+	opts := &Options{}
+	strategy.Register(strategy.Registration{
+		Name:     Name,
+		AddFlags: opts.AddFlags,
+		Validate: opts.Validate,
+		Balances: true,
+		New: func(h strategy.Handle) (strategy.Strategy, error) {
+			source, err := usage.New(opts.Usage, h.MetricsClient)
+			if err != nil {
+				return nil, err
+			}
+			return NewCpuMemUtilAlgo(*opts, source), nil
+		},
+	})
+}
+
+// thresholds are percentages of node resources
+type Options struct {
+	CpuUtilEvictThreshold float64
+	CpuUtilIdleThreshold  float64
+	MemUtilEvictThreshold float64
+	MemUtilIdleThreshold  float64
+	// idle:evict thresholds of other resources by name, cpu and memory
+	// entries override the dedicated options
+	Thresholds map[string]string
+	// how thresholds are read, absolute percentages or deviations from
+	// the mean usage of nodes
+	ThresholdMode string
+	// a node is evicted at the evict threshold of all resources, or any
+	EvictMatch string
+
+	// how node & pod usage is measured
+	Usage usage.Options
+	// denominator of usage percentages, allocatable or capacity
+	Basis string
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.Float64Var(&o.CpuUtilIdleThreshold, "util-cpu-idle-threshold", 20, "util cpu idle threshold")
+	fs.Float64Var(&o.CpuUtilEvictThreshold, "util-cpu-evict-threshold", 60, "util cpu evict threshold")
+	fs.Float64Var(&o.MemUtilIdleThreshold, "util-memory-idle-threshold", 20, "util memory idle threshold")
+	fs.Float64Var(&o.MemUtilEvictThreshold, "util-memory-evict-threshold", 60, "util memory evict threshold")
+	fs.StringToStringVar(&o.Thresholds, "util-thresholds", nil,
+		"idle:evict thresholds of more resources, e.g. ephemeral-storage=20:60,pods=30:80,example.com/foo=10:50")
+	fs.StringVar(&o.ThresholdMode, "util-threshold-mode", ThresholdAbsolute,
+		fmt.Sprintf("how thresholds are read, one of: %s(percentages), %s(idle/evict standard deviations below/above the mean usage of nodes), %s(idle/evict percentage points below/above the mean usage of nodes)",
+			ThresholdAbsolute, ThresholdStdDev, ThresholdPoints))
+	fs.StringVar(&o.EvictMatch, "util-evict-match", EvictMatchAll,
+		fmt.Sprintf("evict nodes at the evict threshold of every resource (%s) or of any resource (%s), and until usage of every resource is below the target threshold with %s",
+			EvictMatchAll, EvictMatchAny, EvictMatchAny))
+	fs.StringVar(&o.Basis, "util-basis", resources.BasisAllocatable,
+		fmt.Sprintf("node resources usage percentages are relative to, one of: %s, %s", resources.BasisAllocatable, resources.BasisCapacity))
+	o.Usage.AddFlags(fs)
+}
+
+func (o *Options) Validate() error {
+	if err := o.Usage.Validate(); err != nil {
+		return err
+	}
+	if o.Basis != resources.BasisAllocatable && o.Basis != resources.BasisCapacity {
+		return fmt.Errorf("illegal util basis %q", o.Basis)
+	}
+	if o.EvictMatch != EvictMatchAll && o.EvictMatch != EvictMatchAny && o.EvictMatch != "" {
+		return fmt.Errorf("illegal util evict match %q", o.EvictMatch)
+	}
+	thresholds, err := o.ResourceThresholds()
+	if err != nil {
+		return err
+	}
+	for name, t := range thresholds {
+		if err := validateThreshold(o.ThresholdMode, t); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Threshold of one resource, percentages of node resources.
+type Threshold struct {
+	Idle, Evict float64
+}
+
+// ResourceThresholds merges the cpu & memory options with the thresholds
+// of other resources.
+func (o *Options) ResourceThresholds() (map[v1.ResourceName]Threshold, error) {
+	ret := map[v1.ResourceName]Threshold{
+		v1.ResourceCPU:    {Idle: o.CpuUtilIdleThreshold, Evict: o.CpuUtilEvictThreshold},
+		v1.ResourceMemory: {Idle: o.MemUtilIdleThreshold, Evict: o.MemUtilEvictThreshold},
+	}
+	for name, value := range o.Thresholds {
+		t, err := parseThreshold(value)
+		if name == "" || err != nil {
+			return nil, fmt.Errorf("illegal util threshold %s=%s, expect <resource>=<idle>:<evict>", name, value)
+		}
+		ret[v1.ResourceName(name)] = t
+	}
+	return ret, nil
+}
+
+func parseThreshold(value string) (Threshold, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return Threshold{}, fmt.Errorf("illegal threshold %q", value)
+	}
+	idle, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return Threshold{}, err
+	}
+	evict, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return Threshold{}, err
+	}
+	return Threshold{Idle: idle, Evict: evict}, nil
 }
 
 type CpuMemUtilAlgo struct {
-	cmuOption
+	thresholds map[v1.ResourceName]Threshold
+	mode       string
+	matchAll   bool
+	usage      resources.UsageSource
+	basis      string
 }
 
-func NewCpuMemUtilAlgo(cfg config.Config) *CpuMemUtilAlgo {
+// NewCpuMemUtilAlgo measures usage by source, pod requests if nil.
+func NewCpuMemUtilAlgo(opt Options, source resources.UsageSource) *CpuMemUtilAlgo {
+	if source == nil {
+		source = resources.RequestsUsage{}
+	}
+	// validated by Options.Validate
+	thresholds, _ := opt.ResourceThresholds()
 	return &CpuMemUtilAlgo{
-		cmuOption{
-			cpuEvictThreshold: cfg.CpuUtilEvictThreshold,
-			cpuIdleThreshold:  cfg.CpuUtilIdleThreshold,
-			memEvictThreshold: cfg.MemUtilEvictThreshold,
-			memIdleThreshold:  cfg.MemUtilIdleThreshold,
-		},
+		thresholds: thresholds,
+		mode:       opt.ThresholdMode,
+		matchAll:   opt.EvictMatch != EvictMatchAny,
+		usage:      source,
+		basis:      opt.Basis,
 	}
 }
 
-func (cmu *CpuMemUtilAlgo) Run(cli clientset.Interface, nodePods map[string]resources.NodeInfoWithPods) error {
-	idles, evicts := cmu.ClassifyNodes(nodePods)
+func (cmu *CpuMemUtilAlgo) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	if err := resources.ValidateUsage(cmu.usage, nodePods); err != nil {
+		return err
+	}
+	thresholds := cmu.Thresholds(nodePods)
+	idles, evicts := cmu.ClassifyNodes(nodePods, thresholds)
+	cmu.reportNodes(rep, nodePods, idles, evicts, thresholds)
 	if len(idles) == 0 || len(evicts) == 0 {
 		log.Printf("cluster is balanced")
 		return nil
 	}
 
-	return cmu.Evict(cli, idles, evicts)
+	return cmu.Evict(pe, idles, evicts, thresholds, rep)
+}
+
+func idleThresholds(thresholds map[v1.ResourceName]Threshold) map[v1.ResourceName]float64 {
+	ret := make(map[v1.ResourceName]float64, len(thresholds))
+	for name, t := range thresholds {
+		ret[name] = t.Idle
+	}
+	return ret
+}
+
+func evictThresholds(thresholds map[v1.ResourceName]Threshold) map[v1.ResourceName]float64 {
+	ret := make(map[v1.ResourceName]float64, len(thresholds))
+	for name, t := range thresholds {
+		ret[name] = t.Evict
+	}
+	return ret
+}
+
+// targetThresholds are in the middle of idle and evict thresholds, evicted
+// nodes are drained and idle nodes filled up to them.
+func targetThresholds(thresholds map[v1.ResourceName]Threshold) map[v1.ResourceName]float64 {
+	ret := make(map[v1.ResourceName]float64, len(thresholds))
+	for name, t := range thresholds {
+		ret[name] = targetThreshold(t.Idle, t.Evict)
+	}
+	return ret
+}
+
+func (cmu *CpuMemUtilAlgo) usagePercentages(info resources.NodeInfoWithPods) map[v1.ResourceName]float64 {
+	usage := cmu.usage.NodeUsage(info)
+	capacity := resources.NodeResources(info.Node, cmu.basis)
+	ret := make(map[v1.ResourceName]float64, len(cmu.thresholds))
+	for name := range cmu.thresholds {
+		ret[name] = resources.ResourceUsagePercentage(name, usage, capacity)
+	}
+	return ret
 }
 
-func (cmu *CpuMemUtilAlgo) ClassifyNodes(nodePods map[string]resources.NodeInfoWithPods) (map[string]resources.NodeInfoWithPods, map[string]resources.NodeInfoWithPods) {
+func (cmu *CpuMemUtilAlgo) reportNodes(rep *report.StrategyReport, nodePods, idles, evicts map[string]resources.NodeInfoWithPods, thresholds map[v1.ResourceName]Threshold) {
+	targets := targetThresholds(thresholds)
+	for nname, info := range nodePods {
+		n := rep.Node(nname)
+		n.Basis = cmu.basis
+		n.Capacity = info.Node.Status.Capacity
+		n.Allocatable = info.Node.Status.Allocatable
+		n.PodCount = len(info.Pods)
+		n.Usage = cmu.usagePercentages(info)
+		n.TargetThreshold = targets
+		if _, ok := idles[nname]; ok {
+			n.Classification = report.NodeIdle
+		}
+		if _, ok := evicts[nname]; ok {
+			n.Classification = report.NodeEvict
+		}
+	}
+}
+
+// ClassifyNodes finds idle nodes, below the idle threshold of every
+// resource, and nodes to evict, at or above the evict threshold of every
+// resource or of any, see EvictMatch. Thresholds are absolute, see Thresholds.
+func (cmu *CpuMemUtilAlgo) ClassifyNodes(nodePods map[string]resources.NodeInfoWithPods, thresholds map[v1.ResourceName]Threshold) (map[string]resources.NodeInfoWithPods, map[string]resources.NodeInfoWithPods) {
 	idle := make(map[string]resources.NodeInfoWithPods)
 	evict := make(map[string]resources.NodeInfoWithPods)
 
+	idles, evicts := idleThresholds(thresholds), evictThresholds(thresholds)
 	for nname, info := range nodePods {
 		if info.Node.Spec.Unschedulable {
 			continue
 		}
-		podsUsage := resources.PodsCpuMemRequest(info.Pods)
-		nodeCapacity := info.Node.Status.Capacity
-		if resources.IsIdleNode(podsUsage, nodeCapacity, cmu.cpuIdleThreshold, cmu.memIdleThreshold) {
+		podsUsage := cmu.usage.NodeUsage(info)
+		nodeCapacity := resources.NodeResources(info.Node, cmu.basis)
+		if resources.IsIdleNode(podsUsage, nodeCapacity, idles) {
 			idle[nname] = info
 			continue
 		}
-		if resources.IsEvictNode(podsUsage, nodeCapacity, cmu.cpuEvictThreshold, cmu.memEvictThreshold) {
+		if resources.IsEvictNode(podsUsage, nodeCapacity, evicts, cmu.matchAll) {
 			evict[nname] = info
 		}
 	}
 	return idle, evict
 }
 
-func (cmu *CpuMemUtilAlgo) Evict(cli clientset.Interface, idles map[string]resources.NodeInfoWithPods, evicts map[string]resources.NodeInfoWithPods) error {
-	cpuTargetThreshold := targetThreshold(cmu.cpuIdleThreshold, cmu.cpuEvictThreshold)
-	memTargetThreshold := targetThreshold(cmu.memIdleThreshold, cmu.memEvictThreshold)
-	totalCpu, totalMem := totalIdleCapacity(idles, cpuTargetThreshold, memTargetThreshold)
-	if totalCpu <= 0 || totalMem <= 0 {
-		log.Printf("no room for pods to reschedule, quit now")
-		return nil
+func (cmu *CpuMemUtilAlgo) Evict(pe *resources.PodEvictor, idles map[string]resources.NodeInfoWithPods, evicts map[string]resources.NodeInfoWithPods,
+	thresholds map[v1.ResourceName]Threshold, rep *report.StrategyReport) error {
+	targets := targetThresholds(thresholds)
+	totals := totalIdleCapacity(cmu.usage, cmu.basis, idles, targets)
+	for name, total := range totals {
+		if total <= 0 {
+			log.Printf("no room of %s for pods to reschedule, quit now", name)
+			return nil
+		}
 	}
 
+	// evict only pods with a concrete destination among the idle nodes,
+	// filling them up to the target threshold
+	placer := simulator.New(idles, placementLimit(cmu.basis, targets))
+
 	refs := make(map[string]struct{})
 	var err error
 	for nodeName, info := range evicts {
-		targetEvictCpu, targetEvictMem := evictCapacity(info, cpuTargetThreshold, memTargetThreshold)
-		if targetEvictCpu > totalCpu {
-			targetEvictCpu = totalCpu
-		}
-		if targetEvictMem > totalMem {
-			targetEvictMem = totalMem
+		target := evictCapacity(cmu.usage, cmu.basis, info, targets)
+		for name, amount := range target {
+			if total, ok := totals[name]; ok && amount > total {
+				target[name] = total
+			}
 		}
 
-		bePods := info.BestEffortPods()
-		buPods := info.BurstablePods()
+		reason := resources.Reason{
+			Code:    ReasonNodeOverutilized,
+			Message: cmu.overutilizedMessage(info, thresholds),
+		}
+		candidates := append(info.BestEffortPods(), info.BurstablePods()...)
+		rep.Node(nodeName).AddCandidates(candidates)
 		var evicted []*v1.Pod
-		evicted, refs, err = resources.EvictTargetQuantityPods(cli, append(bePods, buPods...), targetEvictCpu, targetEvictMem, refs)
+		// a node evicted by all thresholds is done once any usage is down
+		// to the target, one evicted by any once all are
+		evicted, refs, err = resources.EvictTargetQuantityPods(pe, candidates, reason, placer, cmu.usage, target, !cmu.matchAll, refs)
 		if err != nil {
 			return fmt.Errorf("evict pods for node %q failed: %v", nodeName, err)
 		}
-		evictedResource := resources.PodsCpuMemRequest(evicted)
-		evictedCpu := evictedResource[v1.ResourceCPU]
-		evictedMem := evictedResource[v1.ResourceMemory]
-		totalCpu -= float64(evictedCpu.MilliValue())
-		totalMem -= float64(evictedMem.Value())
-		if totalCpu < 0 || totalMem < 0 {
+		evictedResource := resources.PodsUsage(cmu.usage, evicted)
+		var exhausted bool
+		for name := range totals {
+			totals[name] -= resources.ResourceAmount(name, evictedResource[name])
+			if totals[name] < 0 {
+				exhausted = true
+			}
+		}
+		if exhausted {
 			break
 		}
 	}
@@ -102,41 +318,92 @@ func (cmu *CpuMemUtilAlgo) Evict(cli clientset.Interface, idles map[string]resou
 	return nil
 }
 
+// overutilizedMessage lists the resources at or above the evict threshold.
+func (cmu *CpuMemUtilAlgo) overutilizedMessage(info resources.NodeInfoWithPods, thresholds map[v1.ResourceName]Threshold) string {
+	percentages := cmu.usagePercentages(info)
+	capacity := resources.NodeResources(info.Node, cmu.basis)
+	var names []string
+	for name, t := range thresholds {
+		if _, ok := capacity[name]; ok && percentages[name] >= t.Evict {
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+	var usages, evicts []string
+	for _, name := range names {
+		usages = append(usages, fmt.Sprintf("%s %.2f%%", name, percentages[v1.ResourceName(name)]))
+		evicts = append(evicts, fmt.Sprintf("%s %.2f%%", name, thresholds[v1.ResourceName(name)].Evict))
+	}
+	return fmt.Sprintf("node %s above evict threshold %s", strings.Join(usages, ", "), strings.Join(evicts, ", "))
+}
+
+// placementLimit caps resources with a threshold on a destination node at
+// the target threshold, other resources at allocatable.
+func placementLimit(basis string, thresholds map[v1.ResourceName]float64) simulator.LimitFunc {
+	return func(node *v1.Node) v1.ResourceList {
+		limit := node.Status.Allocatable.DeepCopy()
+		capacity := resources.NodeResources(node, basis)
+		for name, threshold := range thresholds {
+			c, ok := capacity[name]
+			if !ok {
+				continue
+			}
+			q := quantity(name, threshold*resources.ResourceAmount(name, c)/100)
+			if l, ok := limit[name]; !ok || q.Cmp(l) < 0 {
+				limit[name] = q
+			}
+		}
+		return limit
+	}
+}
+
+// quantity is the reverse of resources.ResourceAmount.
+func quantity(name v1.ResourceName, amount float64) resource.Quantity {
+	if name == v1.ResourceCPU {
+		return *resource.NewMilliQuantity(int64(amount), resource.DecimalSI)
+	}
+	return *resource.NewQuantity(int64(amount), resource.DecimalSI)
+}
+
 func targetThreshold(idle, evict float64) float64 {
 	return idle + (evict-idle)/2
 }
 
-func totalIdleCapacity(idles map[string]resources.NodeInfoWithPods, cpuThreshold, memThreshold float64) (float64, float64) {
-	var totalCpu, totalMem float64
+// totalIdleCapacity sums the room of idle nodes below the thresholds, for
+// resources any idle node has.
+func totalIdleCapacity(source resources.UsageSource, basis string, idles map[string]resources.NodeInfoWithPods, thresholds map[v1.ResourceName]float64) map[v1.ResourceName]float64 {
+	totals := make(map[v1.ResourceName]float64)
 	for _, info := range idles {
-		usage := resources.PodsCpuMemRequest(info.Pods)
-		capacity := info.Node.Status.Capacity
-
-		cpuUsedPer, memUsedPer := resources.UsagePercentage(usage, capacity)
-		availableCpuPer := cpuThreshold - cpuUsedPer
-		if availableCpuPer > 0 {
-			totalCpu += availableCpuPer * float64(capacity.Cpu().MilliValue()) / 100
-		}
-		availableMemPer := memThreshold - memUsedPer
-		if availableMemPer > 0 {
-			totalMem += availableMemPer * float64(capacity.Memory().Value()) / 100
+		usage := source.NodeUsage(info)
+		capacity := resources.NodeResources(info.Node, basis)
+		for name, threshold := range thresholds {
+			c, ok := capacity[name]
+			if !ok {
+				continue
+			}
+			available := threshold - resources.ResourceUsagePercentage(name, usage, capacity)
+			if available < 0 {
+				available = 0
+			}
+			totals[name] += available * resources.ResourceAmount(name, c) / 100
 		}
 	}
-	return totalCpu, totalMem
+	return totals
 }
 
-func evictCapacity(nodeInfo resources.NodeInfoWithPods, cpuThreshold, memThreshold float64) (float64, float64) {
-	var cpu, mem float64
-	usage := resources.PodsCpuMemRequest(nodeInfo.Pods)
-	capacity := nodeInfo.Node.Status.Capacity
-	cpuUsedPer, memUsedPer := resources.UsagePercentage(usage, capacity)
-	evictCpuPer := cpuUsedPer - cpuThreshold
-	if evictCpuPer > 0 {
-		cpu = evictCpuPer * float64(capacity.Cpu().MilliValue()) / 100
-	}
-	evictMemPer := memUsedPer - memThreshold
-	if evictMemPer > 0 {
-		mem = evictMemPer * float64(capacity.Memory().Value()) / 100
+// evictCapacity returns the amounts of resources above the thresholds.
+func evictCapacity(source resources.UsageSource, basis string, nodeInfo resources.NodeInfoWithPods, thresholds map[v1.ResourceName]float64) map[v1.ResourceName]float64 {
+	usage := source.NodeUsage(nodeInfo)
+	capacity := resources.NodeResources(nodeInfo.Node, basis)
+	ret := make(map[v1.ResourceName]float64)
+	for name, threshold := range thresholds {
+		c, ok := capacity[name]
+		if !ok {
+			continue
+		}
+		if over := resources.ResourceUsagePercentage(name, usage, capacity) - threshold; over > 0 {
+			ret[name] = over * resources.ResourceAmount(name, c) / 100
+		}
 	}
-	return cpu, mem
+	return ret
 }
@@ -5,14 +5,14 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stepdc/podacrobat/pkg/report"
 	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/usage"
 
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"k8s.io/client-go/kubernetes/fake"
 
-	"github.com/stepdc/podacrobat/cmd/app/config"
-
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 
@@ -21,14 +21,13 @@ import (
 )
 
 func TestUtil(t *testing.T) {
-	cfg := config.Config{
-		Policy:                config.NodesLoad,
+	cfg := Options{
 		CpuUtilEvictThreshold: 50,
 		CpuUtilIdleThreshold:  20,
 		MemUtilEvictThreshold: 50,
 		MemUtilIdleThreshold:  20,
 	}
-	algo := NewCpuMemUtilAlgo(cfg)
+	algo := NewCpuMemUtilAlgo(cfg, nil)
 
 	pod1 := genTestPod("test-pod-1", "test-node-1", "ref1", 100, 100)
 	pod2 := genTestPod("test-pod-1", "test-node-1", "ref2", 100, 100)
@@ -71,12 +70,273 @@ func TestUtil(t *testing.T) {
 		node1.Name: resources.NodeInfoWithPods{Node: node1, Pods: node1Pods},
 		node2.Name: resources.NodeInfoWithPods{Node: node2, Pods: node2Pods},
 	}
-	err := algo.Run(fakeCli, nodePods)
+	err := algo.Run(resources.NewPodEvictor(fakeCli, false), nodePods, report.New([]string{Name}, false).Strategy(Name))
 	if err != nil {
 		t.Error(err)
 	}
 }
 
+func TestUtilDryRun(t *testing.T) {
+	cfg := Options{
+		CpuUtilEvictThreshold: 50,
+		CpuUtilIdleThreshold:  20,
+		MemUtilEvictThreshold: 50,
+		MemUtilIdleThreshold:  20,
+	}
+	algo := NewCpuMemUtilAlgo(cfg, nil)
+
+	var node1Pods []*v1.Pod
+	for i := 0; i < 6; i++ {
+		node1Pods = append(node1Pods, genTestPod(fmt.Sprintf("test-pod-%d", i), "test-node-1", fmt.Sprintf("ref%d", i), 100, 100))
+	}
+	node2Pods := []*v1.Pod{genTestPod("test-pod-6", "test-node-2", "ref6", 100, 100)}
+	node1 := genTestNode("test-node-1", 1000, 1000)
+	node2 := genTestNode("test-node-2", 1000, 1000)
+
+	fakeCli := &fake.Clientset{}
+	fakeCli.Fake.AddReactor("post", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		t.Errorf("unexpected eviction in dry run mode: %v", action)
+		return true, nil, nil
+	})
+
+	nodePods := map[string]resources.NodeInfoWithPods{
+		node1.Name: resources.NodeInfoWithPods{Node: node1, Pods: node1Pods},
+		node2.Name: resources.NodeInfoWithPods{Node: node2, Pods: node2Pods},
+	}
+	pe := resources.NewPodEvictor(fakeCli, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := algo.Run(pe, nodePods, rep); err != nil {
+		t.Error(err)
+	}
+	if len(pe.Evicted()) == 0 {
+		t.Errorf("expected eviction plan for %q, got none", node1.Name)
+	}
+	for _, e := range pe.Evicted() {
+		if e.Node != node1.Name {
+			t.Errorf("pod %q planned from node %q, expected %q", e.Pod.Name, e.Node, node1.Name)
+		}
+		if e.Reason == "" {
+			t.Errorf("pod %q planned without reason", e.Pod.Name)
+		}
+	}
+	if c := rep.Node(node1.Name).Classification; c != report.NodeEvict {
+		t.Errorf("node %q classified as %q, expected %q", node1.Name, c, report.NodeEvict)
+	}
+	if c := rep.Node(node2.Name).Classification; c != report.NodeIdle {
+		t.Errorf("node %q classified as %q, expected %q", node2.Name, c, report.NodeIdle)
+	}
+}
+
+func TestUtilBasis(t *testing.T) {
+	// 300m requested of 1 cpu capacity, 500m allocatable
+	node := genTestNode("test-node-1", 1000, 1000)
+	node.Status.Allocatable = v1.ResourceList{
+		v1.ResourceCPU:    *resource.NewMilliQuantity(500, resource.DecimalSI),
+		v1.ResourceMemory: *resource.NewQuantity(500, resource.DecimalSI),
+	}
+	pods := []*v1.Pod{
+		genTestPod("test-pod-1", node.Name, "ref1", 300, 300),
+	}
+	nodePods := map[string]resources.NodeInfoWithPods{node.Name: {Node: node, Pods: pods}}
+
+	for basis, want := range map[string]string{resources.BasisCapacity: report.NodeNeutral, resources.BasisAllocatable: report.NodeEvict} {
+		algo := NewCpuMemUtilAlgo(Options{
+			CpuUtilEvictThreshold: 50,
+			CpuUtilIdleThreshold:  20,
+			MemUtilEvictThreshold: 50,
+			MemUtilIdleThreshold:  20,
+			Basis:                 basis,
+		}, nil)
+		rep := report.New([]string{Name}, true).Strategy(Name)
+		if err := algo.Run(resources.NewPodEvictor(&fake.Clientset{}, true), nodePods, rep); err != nil {
+			t.Fatal(err)
+		}
+		n := rep.Node(node.Name)
+		if n.Classification != want {
+			t.Errorf("basis %s: node classified as %q, expected %q", basis, n.Classification, want)
+		}
+		if n.Basis != basis || n.Capacity == nil || n.Allocatable == nil {
+			t.Errorf("basis %s: expected basis, capacity and allocatable reported, got %+v", basis, n)
+		}
+	}
+}
+
+func TestUtilResourceThresholds(t *testing.T) {
+	// pods are small, node1 is full by pod count only
+	node1 := genTestNode("test-node-1", 1000, 1000)
+	node2 := genTestNode("test-node-2", 1000, 1000)
+	for _, node := range []*v1.Node{node1, node2} {
+		node.Status.Allocatable[v1.ResourcePods] = *resource.NewQuantity(10, resource.DecimalSI)
+	}
+	var node1Pods []*v1.Pod
+	for i := 0; i < 8; i++ {
+		node1Pods = append(node1Pods, genTestPod(fmt.Sprintf("test-pod-%d", i), node1.Name, fmt.Sprintf("ref%d", i), 10, 10))
+	}
+	node2Pods := []*v1.Pod{genTestPod("test-pod-8", node2.Name, "ref8", 10, 10)}
+	nodePods := map[string]resources.NodeInfoWithPods{
+		node1.Name: {Node: node1, Pods: node1Pods},
+		node2.Name: {Node: node2, Pods: node2Pods},
+	}
+
+	opts := Options{
+		CpuUtilEvictThreshold: 50,
+		CpuUtilIdleThreshold:  20,
+		MemUtilEvictThreshold: 50,
+		MemUtilIdleThreshold:  20,
+		Thresholds:            map[string]string{"pods": "20:60"},
+		EvictMatch:            EvictMatchAny,
+		Usage:                 usage.Options{Source: usage.SourceRequests},
+		Basis:                 resources.BasisAllocatable,
+	}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+	rep := report.New([]string{Name}, true).Strategy(Name)
+	if err := NewCpuMemUtilAlgo(opts, nil).Run(pe, nodePods, rep); err != nil {
+		t.Fatal(err)
+	}
+	if c := rep.Node(node1.Name).Classification; c != report.NodeEvict {
+		t.Errorf("node %q classified as %q, expected %q", node1.Name, c, report.NodeEvict)
+	}
+	if u := rep.Node(node1.Name).Usage[v1.ResourcePods]; u != 80 {
+		t.Errorf("expected pods usage 80%%, got %.2f%%", u)
+	}
+	// node2 takes pods up to the 40% target, 3 more pods
+	if n := len(pe.Evicted()); n != 3 {
+		t.Errorf("expected 3 pods evicted, got %d", n)
+	}
+	for _, e := range pe.Evicted() {
+		if !strings.Contains(e.Reason, "pods 80.00%") {
+			t.Errorf("expected pods usage in reason, got %q", e.Reason)
+		}
+	}
+
+	for _, thresholds := range []map[string]string{{"pods": "60"}, {"pods": "a:b"}, {"pods": "60:20"}, {"": "20:60"}} {
+		opts.Thresholds = thresholds
+		if err := opts.Validate(); err == nil {
+			t.Errorf("expected thresholds %v rejected", thresholds)
+		}
+	}
+}
+
+func TestUtilEvictMatch(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		match      string
+		cpu, mem   int
+		classified string
+		evicted    int
+	}{
+		// memory 30% is under its evict threshold
+		{name: "default one under", cpu: 150, mem: 50, classified: report.NodeNeutral},
+		{name: "any one under", match: EvictMatchAny, cpu: 150, mem: 50, classified: report.NodeEvict, evicted: 4},
+		// 90% cpu and 60% memory, memory reaches the 35% target after 3 pods,
+		// cpu after 4
+		{name: "default both over", cpu: 150, mem: 100, classified: report.NodeEvict, evicted: 3},
+		{name: "any both over", match: EvictMatchAny, cpu: 150, mem: 100, classified: report.NodeEvict, evicted: 4},
+	} {
+		node1 := genTestNode("test-node-1", 1000, 1000)
+		var node1Pods []*v1.Pod
+		for i := 0; i < 6; i++ {
+			node1Pods = append(node1Pods, genTestPod(fmt.Sprintf("test-pod-%d", i), node1.Name, fmt.Sprintf("ref%d", i), test.cpu, test.mem))
+		}
+		nodePods := map[string]resources.NodeInfoWithPods{node1.Name: {Node: node1, Pods: node1Pods}}
+		for _, name := range []string{"test-node-2", "test-node-3"} {
+			nodePods[name] = resources.NodeInfoWithPods{Node: genTestNode(name, 1000, 1000)}
+		}
+
+		opts := Options{
+			CpuUtilEvictThreshold: 50,
+			CpuUtilIdleThreshold:  20,
+			MemUtilEvictThreshold: 50,
+			MemUtilIdleThreshold:  20,
+			EvictMatch:            test.match,
+			Usage:                 usage.Options{Source: usage.SourceRequests},
+			Basis:                 resources.BasisAllocatable,
+		}
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+		rep := report.New([]string{Name}, true).Strategy(Name)
+		if err := NewCpuMemUtilAlgo(opts, nil).Run(pe, nodePods, rep); err != nil {
+			t.Fatal(err)
+		}
+		if c := rep.Node(node1.Name).Classification; c != test.classified {
+			t.Errorf("%s: node %q classified as %q, expected %q", test.name, node1.Name, c, test.classified)
+		}
+		if n := len(pe.Evicted()); n != test.evicted {
+			t.Errorf("%s: expected %d pods evicted, got %d", test.name, test.evicted, n)
+		}
+	}
+
+	opts := Options{EvictMatch: "some", Usage: usage.Options{Source: usage.SourceRequests}, Basis: resources.BasisAllocatable}
+	if err := opts.Validate(); err == nil {
+		t.Errorf("expected evict match %q rejected", opts.EvictMatch)
+	}
+}
+
+func TestUtilDeviationThresholds(t *testing.T) {
+	// usage 50%, 60% and 90%, nothing is idle by absolute thresholds
+	nodePods := make(map[string]resources.NodeInfoWithPods)
+	for i, used := range []int{500, 600, 900} {
+		node := genTestNode(fmt.Sprintf("test-node-%d", i), 1000, 1000)
+		var pods []*v1.Pod
+		for j := 0; j < used/100; j++ {
+			pods = append(pods, genTestPod(fmt.Sprintf("test-pod-%d-%d", i, j), node.Name, fmt.Sprintf("ref%d-%d", i, j), 100, 100))
+		}
+		nodePods[node.Name] = resources.NodeInfoWithPods{Node: node, Pods: pods}
+	}
+
+	for _, test := range []struct {
+		mode       string
+		thresholds float64
+	}{
+		{mode: ThresholdStdDev, thresholds: 0.5},
+		{mode: ThresholdPoints, thresholds: 10},
+	} {
+		opts := Options{
+			CpuUtilEvictThreshold: test.thresholds,
+			CpuUtilIdleThreshold:  test.thresholds,
+			MemUtilEvictThreshold: test.thresholds,
+			MemUtilIdleThreshold:  test.thresholds,
+			ThresholdMode:         test.mode,
+			Usage:                 usage.Options{Source: usage.SourceRequests},
+			Basis:                 resources.BasisAllocatable,
+		}
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("%s: %v", test.mode, err)
+		}
+		pe := resources.NewPodEvictor(&fake.Clientset{}, true)
+		rep := report.New([]string{Name}, true).Strategy(Name)
+		if err := NewCpuMemUtilAlgo(opts, nil).Run(pe, nodePods, rep); err != nil {
+			t.Fatal(err)
+		}
+		for node, want := range map[string]string{"test-node-0": report.NodeIdle, "test-node-1": report.NodeNeutral, "test-node-2": report.NodeEvict} {
+			if c := rep.Node(node).Classification; c != want {
+				t.Errorf("%s: node %q classified as %q, expected %q", test.mode, node, c, want)
+			}
+		}
+		if len(pe.Evicted()) == 0 {
+			t.Errorf("%s: expected eviction plan, got none", test.mode)
+		}
+	}
+
+	invalid := []Options{
+		{CpuUtilIdleThreshold: -1, ThresholdMode: ThresholdStdDev},
+		{CpuUtilEvictThreshold: 101, ThresholdMode: ThresholdPoints},
+		{ThresholdMode: "relative"},
+	}
+	for _, opts := range invalid {
+		opts.Usage.Source = usage.SourceRequests
+		opts.Basis = resources.BasisAllocatable
+		if err := opts.Validate(); err == nil {
+			t.Errorf("expected %+v rejected", opts)
+		}
+	}
+}
+
 func genTestPod(name, nodeName, refName string, cpu, mem int) *v1.Pod {
 	pod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stepdc/podacrobat/pkg/acrobat"
+	"github.com/stepdc/podacrobat/pkg/resources"
+)
+
+// Controller rebalances the cluster on a fixed interval until stopped,
+// recent evictions are kept in memory to honor the cooldown.
+type Controller struct {
+	// held while running, a new leadership term waits for the passes of
+	// the lost one to stop
+	mu       sync.Mutex
+	acrobat  *acrobat.Acrobat
+	interval time.Duration
+}
+
+func New(a *acrobat.Acrobat, interval, cooldown time.Duration) *Controller {
+	a.SetHistory(resources.NewEvictionHistory(cooldown))
+	return &Controller{
+		acrobat:  a,
+		interval: interval,
+	}
+}
+
+// Run blocks until ctx is done, a pass in progress stops evicting as soon
+// as ctx is canceled. The acrobat caches must have been started.
+func (c *Controller) Run(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	log.Printf("start controller, interval %v", c.interval)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := c.acrobat.RunOnce(ctx); err != nil {
+			log.Printf("balance failed: %v", err)
+		}
+		log.Printf("balance finished in %v", time.Since(start))
+
+		select {
+		case <-ctx.Done():
+			log.Printf("controller stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stepdc/podacrobat/cmd/app/config"
+	"github.com/stepdc/podacrobat/pkg/acrobat"
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+	"github.com/stepdc/podacrobat/pkg/strategy"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+// evictAllStrategy evicts every pod it sees.
+type evictAllStrategy struct{}
+
+func (evictAllStrategy) Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error {
+	for _, info := range nodePods {
+		if _, _, err := resources.EvictPods(pe, info.Pods, resources.Reason{Code: "Test", Message: "test"}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	strategy.Register(strategy.Registration{
+		Name: "test-evict-all",
+		New:  func(strategy.Handle) (strategy.Strategy, error) { return evictAllStrategy{}, nil },
+	})
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	objects := []runtime.Object{&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}},
+	}}
+	for _, name := range []string{"a", "b", "c"} {
+		objects = append(objects, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            name,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: name, UID: types.UID("uid-" + name)}},
+			},
+			Spec:   v1.PodSpec{NodeName: "node1"},
+			Status: v1.PodStatus{Phase: v1.PodRunning},
+		})
+	}
+	cli := fake.NewSimpleClientset(objects...)
+	pa := &config.PodAcrobat{
+		Config: config.Config{Policies: []string{"test-evict-all"}},
+		Client: cli,
+	}
+	a, err := acrobat.New(pa, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheCtx, cacheCancel := context.WithCancel(context.Background())
+	defer cacheCancel()
+	if err := a.Start(cacheCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	// canceled, e.g. by losing leadership, right after the first eviction
+	ctx, cancel := context.WithCancel(context.Background())
+	var evictions int
+	cli.PrependReactor("post", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "eviction" {
+			evictions++
+			cancel()
+		}
+		return false, nil, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		New(a, time.Hour, time.Hour).Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("controller did not stop after cancel")
+	}
+	if evictions != 1 {
+		t.Errorf("expected the pass to stop after 1 eviction, got %d", evictions)
+	}
+}
@@ -0,0 +1,90 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/stepdc/podacrobat/cmd/app/config"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+)
+
+// Run calls run with a context canceled as soon as the leadership is lost,
+// then campaigns again until ctx is done. Run returns, and campaigns again,
+// only after run returned.
+func Run(ctx context.Context, cli clientset.Interface, opts config.LeaderElectionOptions, run func(ctx context.Context)) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("get hostname failed: %v", err)
+	}
+	identity := hostname + "_" + string(uuid.NewUUID())
+
+	lock := &LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{Namespace: opts.LeaseNamespace, Name: opts.LeaseName},
+		Client:    cli.CoordinationV1beta1(),
+		identity:  identity,
+	}
+	log.Printf("campaign for lease %s as %s", lock.Describe(), identity)
+	for ctx.Err() == nil {
+		t := &term{}
+		le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: opts.LeaseDuration,
+			RenewDeadline: opts.RenewDeadline,
+			RetryPeriod:   opts.RetryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					t.run(ctx, run)
+				},
+				OnStoppedLeading: func() {
+					log.Printf("%s stopped leading", identity)
+				},
+				OnNewLeader: func(leader string) {
+					log.Printf("new leader %s", leader)
+				},
+			},
+			Name: opts.LeaseName,
+		})
+		if err != nil {
+			return fmt.Errorf("build leader elector failed: %v", err)
+		}
+		le.Run(ctx)
+		t.end()
+	}
+	return nil
+}
+
+// term tracks run during one leadership, the elector starts it in a
+// goroutine it does not wait for.
+type term struct {
+	mu    sync.Mutex
+	ended bool
+	wg    sync.WaitGroup
+}
+
+func (t *term) run(ctx context.Context, run func(ctx context.Context)) {
+	t.mu.Lock()
+	if t.ended {
+		// started after the elector returned, the leadership is gone
+		t.mu.Unlock()
+		return
+	}
+	t.wg.Add(1)
+	t.mu.Unlock()
+	defer t.wg.Done()
+	run(ctx)
+}
+
+// end waits for a started run and keeps a late one from starting.
+func (t *term) end() {
+	t.mu.Lock()
+	t.ended = true
+	t.mu.Unlock()
+	t.wg.Wait()
+}
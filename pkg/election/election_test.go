@@ -0,0 +1,62 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stepdc/podacrobat/cmd/app/config"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestRunLostLeadership(t *testing.T) {
+	fakeCli := fake.NewSimpleClientset()
+	// the lease is created, but never renewed
+	fakeCli.PrependReactor("update", "leases", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("update lease refused")
+	})
+	opts := config.LeaderElectionOptions{
+		LeaseName:      "podacrobat",
+		LeaseNamespace: "kube-system",
+		LeaseDuration:  300 * time.Millisecond,
+		RenewDeadline:  200 * time.Millisecond,
+		RetryPeriod:    50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost := make(chan struct{})
+	var finished int32
+	run := func(ctx context.Context) {
+		<-ctx.Done()
+		close(lost)
+		// Run must wait for the pass to wind down
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- Run(ctx, fakeCli, opts, run) }()
+
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected pass context canceled when the lease is not renewed")
+	}
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected run to return after ctx canceled")
+	}
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Errorf("expected run to return only after the pass returned")
+	}
+}
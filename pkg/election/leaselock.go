@@ -0,0 +1,98 @@
+package election
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1beta1"
+	rl "k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaseLock stores the leader election record in a coordination.k8s.io
+// Lease, client-go only ships endpoints and configmaps locks so far.
+type LeaseLock struct {
+	LeaseMeta metav1.ObjectMeta
+	Client    coordinationclient.LeasesGetter
+	identity  string
+	lease     *coordinationv1beta1.Lease
+}
+
+var _ rl.Interface = &LeaseLock{}
+
+func (ll *LeaseLock) Get() (*rl.LeaderElectionRecord, error) {
+	var err error
+	ll.lease, err = ll.Client.Leases(ll.LeaseMeta.Namespace).Get(ll.LeaseMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return leaseSpecToRecord(&ll.lease.Spec), nil
+}
+
+func (ll *LeaseLock) Create(ler rl.LeaderElectionRecord) error {
+	var err error
+	ll.lease, err = ll.Client.Leases(ll.LeaseMeta.Namespace).Create(&coordinationv1beta1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ll.LeaseMeta.Name,
+			Namespace: ll.LeaseMeta.Namespace,
+		},
+		Spec: recordToLeaseSpec(&ler),
+	})
+	return err
+}
+
+func (ll *LeaseLock) Update(ler rl.LeaderElectionRecord) error {
+	if ll.lease == nil {
+		return errors.New("lease not initialized, call get or create first")
+	}
+	ll.lease.Spec = recordToLeaseSpec(&ler)
+	var err error
+	ll.lease, err = ll.Client.Leases(ll.LeaseMeta.Namespace).Update(ll.lease)
+	return err
+}
+
+func (ll *LeaseLock) RecordEvent(s string) {
+	log.Printf("lease %s: %s %s", ll.Describe(), ll.identity, s)
+}
+
+func (ll *LeaseLock) Identity() string {
+	return ll.identity
+}
+
+func (ll *LeaseLock) Describe() string {
+	return fmt.Sprintf("%v/%v", ll.LeaseMeta.Namespace, ll.LeaseMeta.Name)
+}
+
+func leaseSpecToRecord(spec *coordinationv1beta1.LeaseSpec) *rl.LeaderElectionRecord {
+	var r rl.LeaderElectionRecord
+	if spec.HolderIdentity != nil {
+		r.HolderIdentity = *spec.HolderIdentity
+	}
+	if spec.LeaseDurationSeconds != nil {
+		r.LeaseDurationSeconds = int(*spec.LeaseDurationSeconds)
+	}
+	if spec.LeaseTransitions != nil {
+		r.LeaderTransitions = int(*spec.LeaseTransitions)
+	}
+	if spec.AcquireTime != nil {
+		r.AcquireTime = metav1.Time{Time: spec.AcquireTime.Time}
+	}
+	if spec.RenewTime != nil {
+		r.RenewTime = metav1.Time{Time: spec.RenewTime.Time}
+	}
+	return &r
+}
+
+func recordToLeaseSpec(ler *rl.LeaderElectionRecord) coordinationv1beta1.LeaseSpec {
+	duration := int32(ler.LeaseDurationSeconds)
+	transitions := int32(ler.LeaderTransitions)
+	return coordinationv1beta1.LeaseSpec{
+		HolderIdentity:       &ler.HolderIdentity,
+		LeaseDurationSeconds: &duration,
+		AcquireTime:          &metav1.MicroTime{Time: ler.AcquireTime.Time},
+		RenewTime:            &metav1.MicroTime{Time: ler.RenewTime.Time},
+		LeaseTransitions:     &transitions,
+	}
+}
@@ -0,0 +1,49 @@
+package election
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	rl "k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestLeaseLock(t *testing.T) {
+	fakeCli := fake.NewSimpleClientset()
+	lock := &LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "podacrobat"},
+		Client:    fakeCli.CoordinationV1beta1(),
+		identity:  "replica-1",
+	}
+
+	if _, err := lock.Get(); err == nil {
+		t.Fatalf("expected get of missing lease to fail")
+	}
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	record := rl.LeaderElectionRecord{
+		HolderIdentity:       "replica-1",
+		LeaseDurationSeconds: 15,
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+	if err := lock.Create(record); err != nil {
+		t.Fatalf("create lease failed: %v", err)
+	}
+
+	record.HolderIdentity = "replica-2"
+	record.LeaderTransitions = 1
+	if err := lock.Update(record); err != nil {
+		t.Fatalf("update lease failed: %v", err)
+	}
+	got, err := lock.Get()
+	if err != nil {
+		t.Fatalf("get lease failed: %v", err)
+	}
+	if got.HolderIdentity != "replica-2" || got.LeaderTransitions != 1 || got.LeaseDurationSeconds != 15 {
+		t.Errorf("unexpected record %+v", got)
+	}
+	if !got.RenewTime.Equal(&now) {
+		t.Errorf("expected renew time %v, got %v", now, got.RenewTime)
+	}
+}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+const namespace = "podacrobat"
+
+const lastSuccessfulRunName = namespace + "_last_successful_run_timestamp_seconds"
+
+var evictionLabels = []string{"node", "namespace", "strategy", "reason"}
+
+var (
+	EvictionsAttempted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evictions_attempted_total",
+		Help:      "Evictions sent to the eviction api.",
+	}, evictionLabels)
+	EvictionsSucceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evictions_succeeded_total",
+		Help:      "Evictions accepted by the eviction api.",
+	}, evictionLabels)
+	EvictionsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evictions_failed_total",
+		Help:      "Evictions rejected by the eviction api or failed.",
+	}, evictionLabels)
+
+	NodeUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_usage_percent",
+		Help:      "Node usage percentage seen by a strategy in the last run.",
+	}, []string{"node", "strategy", "resource"})
+	NodeClassification = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_classification",
+		Help:      "Node classification by a strategy in the last run, 1 for the current one.",
+	}, []string{"node", "strategy", "classification"})
+
+	RunDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "run_duration_seconds",
+		Help:      "Duration of balance runs.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+	})
+	LastSuccessfulRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_run_timestamp_seconds",
+		Help:      "Unix time of the last run finished without error.",
+	})
+
+	APIRequestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of kubernetes api requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"verb"})
+	APIRequestResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Kubernetes api requests by status code.",
+	}, []string{"code", "method"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		EvictionsAttempted,
+		EvictionsSucceeded,
+		EvictionsFailed,
+		NodeUsage,
+		NodeClassification,
+		RunDuration,
+		LastSuccessfulRun,
+		APIRequestLatency,
+		APIRequestResults,
+	)
+	clientmetrics.Register(latencyAdapter{}, resultAdapter{})
+}
+
+// latencyAdapter feeds client-go request latency, the url is left out
+// as it carries object names.
+type latencyAdapter struct{}
+
+func (latencyAdapter) Observe(verb string, u url.URL, latency time.Duration) {
+	APIRequestLatency.WithLabelValues(verb).Observe(latency.Seconds())
+}
+
+type resultAdapter struct{}
+
+func (resultAdapter) Increment(code, method, host string) {
+	APIRequestResults.WithLabelValues(code, method).Inc()
+}
+
+// ObserveRun records the duration of a run, and its end time if it
+// succeeded.
+func ObserveRun(start time.Time, err error) {
+	RunDuration.Observe(time.Since(start).Seconds())
+	if err == nil {
+		LastSuccessfulRun.SetToCurrentTime()
+	}
+}
+
+// ObserveReport replaces the node gauges with the ones of the last run,
+// so removed nodes do not linger.
+func ObserveReport(rep *report.Report) {
+	NodeUsage.Reset()
+	NodeClassification.Reset()
+	for _, s := range rep.Strategies {
+		for _, n := range s.Nodes {
+			for resource, usage := range n.Usage {
+				NodeUsage.WithLabelValues(n.Name, s.Name, string(resource)).Set(usage)
+			}
+			NodeClassification.WithLabelValues(n.Name, s.Name, n.Classification).Set(1)
+		}
+	}
+}
+
+// Serve exposes /metrics on addr in the background.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Printf("serve metrics on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("serve metrics failed: %v", err)
+		}
+	}()
+}
+
+// Push sends all metrics to a pushgateway, for runs too short to scrape.
+// A failed run is added without the last successful run timestamp, so the
+// one pushed by the last successful run is kept.
+func Push(url, job string, succeeded bool) error {
+	if succeeded {
+		return push.New(url, job).Gatherer(prometheus.DefaultGatherer).Push()
+	}
+	return push.New(url, job).Gatherer(prometheus.GathererFunc(gatherFailed)).Add()
+}
+
+func gatherFailed() ([]*dto.MetricFamily, error) {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	kept := mfs[:0]
+	for _, mf := range mfs {
+		if mf.GetName() != lastSuccessfulRunName {
+			kept = append(kept, mf)
+		}
+	}
+	return kept, err
+}
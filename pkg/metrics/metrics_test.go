@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stepdc/podacrobat/pkg/report"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestObserveReport(t *testing.T) {
+	rep := report.New([]string{"nodesutil"}, false)
+	n := rep.Strategy("nodesutil").Node("node1")
+	n.Classification = report.NodeEvict
+	n.Usage = map[v1.ResourceName]float64{v1.ResourceCPU: 75}
+	ObserveReport(rep)
+
+	if got := testutil.ToFloat64(NodeUsage.WithLabelValues("node1", "nodesutil", "cpu")); got != 75 {
+		t.Errorf("expected cpu usage 75, got %v", got)
+	}
+	if got := testutil.ToFloat64(NodeClassification.WithLabelValues("node1", "nodesutil", report.NodeEvict)); got != 1 {
+		t.Errorf("expected node1 classified evict, got %v", got)
+	}
+
+	// nodes gone from the next report are dropped
+	ObserveReport(report.New([]string{"nodesutil"}, false))
+	ch := make(chan prometheus.Metric, 1)
+	NodeUsage.Collect(ch)
+	close(ch)
+	if got := len(ch); got != 0 {
+		t.Errorf("expected stale usage dropped, got %d series", got)
+	}
+}
+
+func TestPush(t *testing.T) {
+	var method, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		method, body = r.Method, string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	ObserveRun(time.Now(), nil)
+
+	if err := Push(srv.URL, "podacrobat", true); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if method != http.MethodPut || !strings.Contains(body, lastSuccessfulRunName) {
+		t.Errorf("expected successful run replacing the group with its timestamp, got %s", method)
+	}
+
+	// a failed run must not overwrite the timestamp of the last successful one
+	if err := Push(srv.URL, "podacrobat", false); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if method != http.MethodPost || strings.Contains(body, lastSuccessfulRunName) {
+		t.Errorf("expected failed run added without the timestamp, got %s", method)
+	}
+	if !strings.Contains(body, "podacrobat_run_duration_seconds") {
+		t.Errorf("expected failed run pushing its duration")
+	}
+}
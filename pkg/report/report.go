@@ -0,0 +1,174 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+const (
+	NodeIdle    = "idle"
+	NodeEvict   = "evict"
+	NodeNeutral = "neutral"
+)
+
+// Report is the machine readable result of one run.
+type Report struct {
+	Policies   []string          `json:"policies"`
+	DryRun     bool              `json:"dryRun"`
+	StartTime  time.Time         `json:"startTime"`
+	EndTime    time.Time         `json:"endTime"`
+	Strategies []*StrategyReport `json:"strategies"`
+	// nodes left out of balancing and why
+	ExcludedNodes []ExcludedNode `json:"excludedNodes,omitempty"`
+	Evicted       []PodReport    `json:"evicted"`
+	Skipped       []PodReport    `json:"skipped"`
+	Errors        []string       `json:"errors,omitempty"`
+}
+
+// StrategyReport holds the node classification of one strategy in the pipeline.
+type StrategyReport struct {
+	Name  string        `json:"name"`
+	Nodes []*NodeReport `json:"nodes"`
+	// index of Nodes by name
+	nodes map[string]*NodeReport
+}
+
+type NodeReport struct {
+	Name           string `json:"name"`
+	Classification string `json:"classification"`
+	PodCount       int    `json:"podCount"`
+	// usage and target thresholds by resource name, unit is percentage
+	// of the basis, allocatable or capacity
+	Basis           string                      `json:"basis,omitempty"`
+	Capacity        v1.ResourceList             `json:"capacity,omitempty"`
+	Allocatable     v1.ResourceList             `json:"allocatable,omitempty"`
+	Usage           map[v1.ResourceName]float64 `json:"usage,omitempty"`
+	TargetThreshold map[v1.ResourceName]float64 `json:"targetThreshold,omitempty"`
+	Candidates      []string                    `json:"candidates,omitempty"`
+}
+
+type ExcludedNode struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type PodReport struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Node      string `json:"node"`
+	Strategy  string `json:"strategy,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+func New(policies []string, dryRun bool) *Report {
+	return &Report{
+		Policies:  policies,
+		DryRun:    dryRun,
+		StartTime: time.Now(),
+	}
+}
+
+// Strategy returns the report entry of strategy name, adding it if absent.
+func (r *Report) Strategy(name string) *StrategyReport {
+	for _, s := range r.Strategies {
+		if s.Name == name {
+			return s
+		}
+	}
+	s := &StrategyReport{Name: name}
+	r.Strategies = append(r.Strategies, s)
+	return s
+}
+
+// Node returns the report entry of node name, adding it if absent.
+func (r *StrategyReport) Node(name string) *NodeReport {
+	if r.nodes == nil {
+		r.nodes = make(map[string]*NodeReport, len(r.Nodes))
+		for _, n := range r.Nodes {
+			r.nodes[n.Name] = n
+		}
+	}
+	if n, ok := r.nodes[name]; ok {
+		return n
+	}
+	n := &NodeReport{Name: name, Classification: NodeNeutral}
+	r.Nodes = append(r.Nodes, n)
+	r.nodes[name] = n
+	return n
+}
+
+func (r *Report) AddEvicted(pod *v1.Pod, node, strategy, reason string) {
+	r.Evicted = append(r.Evicted, newPodReport(pod, node, strategy, reason))
+}
+
+func (r *Report) AddSkipped(pod *v1.Pod, node, strategy, reason string) {
+	r.Skipped = append(r.Skipped, newPodReport(pod, node, strategy, reason))
+}
+
+func (r *Report) AddExcludedNode(name, reason string) {
+	r.ExcludedNodes = append(r.ExcludedNodes, ExcludedNode{Name: name, Reason: reason})
+}
+
+func (r *Report) AddError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+func (n *NodeReport) AddCandidates(pods []*v1.Pod) {
+	for _, pod := range pods {
+		n.Candidates = append(n.Candidates, pod.Namespace+"/"+pod.Name)
+	}
+}
+
+func newPodReport(pod *v1.Pod, node, strategy, reason string) PodReport {
+	return PodReport{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Node:      node,
+		Strategy:  strategy,
+		Reason:    reason,
+	}
+}
+
+func ValidateOutput(format string) error {
+	switch format {
+	case "", OutputJSON, OutputYAML:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
+
+// Write encodes the report in json or yaml format.
+func (r *Report) Write(out io.Writer, format string) error {
+	for _, s := range r.Strategies {
+		sort.Slice(s.Nodes, func(i, j int) bool { return s.Nodes[i].Name < s.Nodes[j].Name })
+	}
+	sort.Slice(r.ExcludedNodes, func(i, j int) bool { return r.ExcludedNodes[i].Name < r.ExcludedNodes[j].Name })
+
+	var data []byte
+	var err error
+	switch format {
+	case OutputJSON:
+		data, err = json.MarshalIndent(r, "", "  ")
+		data = append(data, '\n')
+	case OutputYAML:
+		data, err = yaml.Marshal(r)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("encode report failed: %v", err)
+	}
+	_, err = out.Write(data)
+	return err
+}
@@ -0,0 +1,86 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestReportWrite(t *testing.T) {
+	r := New([]string{"nodesutil"}, true)
+	s := r.Strategy("nodesutil")
+	if r.Strategy("nodesutil") != s {
+		t.Fatalf("expected the same strategy report")
+	}
+	busy := s.Node("node2")
+	busy.Classification = NodeEvict
+	busy.PodCount = 2
+	busy.Usage = map[v1.ResourceName]float64{v1.ResourceCPU: 80}
+	s.Node("node1").Classification = NodeIdle
+	if s.Node("node2") != busy {
+		t.Fatalf("expected the same node report")
+	}
+	web := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	db := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"}}
+	busy.AddCandidates([]*v1.Pod{web, db})
+	r.AddEvicted(web, "node2", "nodesutil", "node overutilized")
+	r.AddSkipped(db, "node2", "nodesutil", "local storage")
+	r.AddExcludedNode("node3", "cordoned")
+	r.AddError(errors.New("boom"))
+
+	var out bytes.Buffer
+	if err := r.Write(&out, OutputJSON); err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &raw); err != nil {
+		t.Fatalf("decode json failed: %v", err)
+	}
+	for _, key := range []string{"policies", "dryRun", "startTime", "endTime", "strategies", "excludedNodes", "evicted", "skipped", "errors"} {
+		if _, ok := raw[key]; !ok {
+			t.Errorf("expected key %q in json report", key)
+		}
+	}
+	if !strings.Contains(out.String(), `"classification": "evict"`) || !strings.Contains(out.String(), `"cpu": 80`) {
+		t.Errorf("expected classification and usage in json report, got %s", out.String())
+	}
+
+	for _, format := range []string{OutputJSON, OutputYAML} {
+		out.Reset()
+		if err := r.Write(&out, format); err != nil {
+			t.Fatal(err)
+		}
+		var got Report
+		if err := yaml.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("%s: decode failed: %v", format, err)
+		}
+		nodes := got.Strategies[0].Nodes
+		if len(nodes) != 2 || nodes[0].Name != "node1" || nodes[0].Classification != NodeIdle || nodes[1].Classification != NodeEvict {
+			t.Errorf("%s: expected nodes sorted with classification, got %+v", format, nodes)
+		}
+		if !reflect.DeepEqual(nodes[1].Candidates, []string{"default/web", "default/db"}) {
+			t.Errorf("%s: unexpected candidates %v", format, nodes[1].Candidates)
+		}
+		want := PodReport{Namespace: "default", Name: "web", Node: "node2", Strategy: "nodesutil", Reason: "node overutilized"}
+		if len(got.Evicted) != 1 || got.Evicted[0] != want {
+			t.Errorf("%s: unexpected evicted %+v", format, got.Evicted)
+		}
+		if len(got.Skipped) != 1 || got.Skipped[0].Name != "db" || got.Skipped[0].Reason != "local storage" {
+			t.Errorf("%s: unexpected skipped %+v", format, got.Skipped)
+		}
+		if !got.DryRun || len(got.ExcludedNodes) != 1 || len(got.Errors) != 1 {
+			t.Errorf("%s: unexpected report %+v", format, got)
+		}
+	}
+
+	if err := r.Write(&out, "xml"); err == nil {
+		t.Errorf("expected unsupported format rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package resources
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+var controlPlaneLabels = []string{
+	"node-role.kubernetes.io/master",
+	"node-role.kubernetes.io/control-plane",
+}
+
+var pressureConditions = []v1.NodeConditionType{
+	v1.NodeMemoryPressure,
+	v1.NodeDiskPressure,
+	v1.NodePIDPressure,
+}
+
+// NodeEligibility decides which nodes take part in balancing, a node must
+// be Ready in any case.
+type NodeEligibility struct {
+	// exclude nodes under memory, disk or pid pressure
+	ExcludePressure bool
+	// exclude nodes with NoSchedule or NoExecute taints
+	ExcludeTainted bool
+	// exclude nodes labeled as control plane
+	ExcludeControlPlane bool
+	// exclude unschedulable nodes
+	ExcludeCordoned bool
+}
+
+// Reason returns why the node is not eligible, empty if it is.
+func (e *NodeEligibility) Reason(node *v1.Node) string {
+	if !IsNodeReady(node) {
+		return "not ready"
+	}
+	if e.ExcludeCordoned && node.Spec.Unschedulable {
+		return "cordoned"
+	}
+	if e.ExcludeControlPlane {
+		for _, label := range controlPlaneLabels {
+			if _, ok := node.Labels[label]; ok {
+				return fmt.Sprintf("control plane node, label %s", label)
+			}
+		}
+	}
+	if e.ExcludePressure {
+		for _, cond := range node.Status.Conditions {
+			for _, pressure := range pressureConditions {
+				if cond.Type == pressure && cond.Status == v1.ConditionTrue {
+					return fmt.Sprintf("condition %s", cond.Type)
+				}
+			}
+		}
+	}
+	if e.ExcludeTainted {
+		for _, taint := range node.Spec.Taints {
+			if taint.Effect == v1.TaintEffectNoSchedule || taint.Effect == v1.TaintEffectNoExecute {
+				return fmt.Sprintf("taint %s:%s", taint.Key, taint.Effect)
+			}
+		}
+	}
+	return ""
+}
+
+// IsNodeReady reports whether the node has a true Ready condition.
+func IsNodeReady(node *v1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// FilterEligibleNodes splits the snapshot into eligible nodes and the
+// reasons the others are excluded, by node name.
+func FilterEligibleNodes(nodePods map[string]NodeInfoWithPods, e *NodeEligibility) (map[string]NodeInfoWithPods, map[string]string) {
+	eligible := make(map[string]NodeInfoWithPods)
+	excluded := make(map[string]string)
+	for name, info := range nodePods {
+		if reason := e.Reason(info.Node); reason != "" {
+			excluded[name] = reason
+			continue
+		}
+		eligible[name] = info
+	}
+	return eligible, excluded
+}
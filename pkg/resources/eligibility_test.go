@@ -0,0 +1,60 @@
+package resources
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeEligibility(t *testing.T) {
+	e := &NodeEligibility{ExcludePressure: true, ExcludeTainted: true, ExcludeControlPlane: true, ExcludeCordoned: true}
+
+	ready := genEligibilityTestNode("ready")
+	notReady := genEligibilityTestNode("not-ready")
+	notReady.Status.Conditions[0].Status = v1.ConditionFalse
+	noCondition := genEligibilityTestNode("no-condition")
+	noCondition.Status.Conditions = nil
+	pressure := genEligibilityTestNode("pressure")
+	pressure.Status.Conditions[1].Status = v1.ConditionTrue
+	tainted := genEligibilityTestNode("tainted")
+	tainted.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	preferTainted := genEligibilityTestNode("prefer-tainted")
+	preferTainted.Spec.Taints = []v1.Taint{{Key: "dedicated", Effect: v1.TaintEffectPreferNoSchedule}}
+	master := genEligibilityTestNode("master")
+	master.Labels = map[string]string{"node-role.kubernetes.io/master": ""}
+	cordoned := genEligibilityTestNode("cordoned")
+	cordoned.Spec.Unschedulable = true
+
+	nodePods := make(map[string]NodeInfoWithPods)
+	for _, node := range []*v1.Node{ready, notReady, noCondition, pressure, tainted, preferTainted, master, cordoned} {
+		nodePods[node.Name] = NodeInfoWithPods{Node: node}
+	}
+	eligible, excluded := FilterEligibleNodes(nodePods, e)
+	if len(eligible) != 2 {
+		t.Errorf("expected ready and prefer-tainted eligible, got %v", eligible)
+	}
+	for _, name := range []string{"not-ready", "no-condition", "pressure", "tainted", "master", "cordoned"} {
+		if excluded[name] == "" {
+			t.Errorf("expected %s excluded with a reason", name)
+		}
+	}
+
+	// a ready node under pressure is fine if not configured otherwise
+	if reason := (&NodeEligibility{}).Reason(pressure); reason != "" {
+		t.Errorf("expected pressure node eligible, got %q", reason)
+	}
+}
+
+func genEligibilityTestNode(name string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue},
+				{Type: v1.NodeMemoryPressure, Status: v1.ConditionFalse},
+				{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse},
+			},
+		},
+	}
+}
@@ -0,0 +1,311 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/stepdc/podacrobat/pkg/metrics"
+
+	v1 "k8s.io/api/core/v1"
+	policyvb1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+var ErrEvictionBudgetExceeded = errors.New("eviction budget exceeded")
+
+// ErrPodSkipped means the pod is left in place, the reason is recorded
+// in the skipped list and the caller should go on with the next pod.
+var ErrPodSkipped = errors.New("pod skipped")
+
+// Placer finds a destination node for a pod before it is evicted, and
+// reserves the capacity there. The node is empty if the pod fits nowhere.
+type Placer interface {
+	Place(pod *v1.Pod) (node string, reason string)
+	Unreserve(pod *v1.Pod, node string)
+}
+
+// skip reason codes
+const (
+	ReasonNotEvictable     = "NotEvictable"
+	ReasonFilteredOut      = "FilteredOut"
+	ReasonOwnerEvicted     = "OwnerAlreadyEvicted"
+	ReasonNoDestination    = "NoDestination"
+	ReasonCooldown         = "EvictionCooldown"
+	ReasonDisruptionBudget = "DisruptionBudgetExceeded"
+	ReasonEvictionRejected = "EvictionRejected"
+	ReasonEvictionFailed   = "EvictionFailed"
+)
+
+// Reason tells why a pod is evicted or skipped. Code is a short CamelCase
+// cause fit for metric labels and event reasons, Message carries the details.
+type Reason struct {
+	Code    string
+	Message string
+}
+
+// EvictionRecord records one eviction or skip decision.
+type EvictionRecord struct {
+	Pod      *v1.Pod
+	Node     string
+	Strategy string
+	Code     string
+	Reason   string
+}
+
+// PodEvictor evicts pods through the eviction api, or only records them in
+// dry run mode, so the algorithms can run their full logic either way.
+// One evictor is shared by all strategies of a run, so the budget is global
+// and a pod is never evicted twice.
+type PodEvictor struct {
+	ctx    context.Context
+	cli    clientset.Interface
+	dryRun bool
+	// 0 for unlimited
+	maxPods  int
+	strategy string
+
+	budgets    []*disruptionBudget
+	history    *EvictionHistory
+	recorder   record.EventRecorder
+	namespaces map[string]*v1.Namespace
+	filter     *PodFilter
+
+	evictedSet map[string]struct{}
+	evicted    []EvictionRecord
+	skipped    []EvictionRecord
+}
+
+func NewPodEvictor(cli clientset.Interface, dryRun bool) *PodEvictor {
+	return &PodEvictor{
+		ctx:        context.Background(),
+		cli:        cli,
+		dryRun:     dryRun,
+		evictedSet: make(map[string]struct{}),
+	}
+}
+
+// SetContext stops evictions once ctx is done, e.g. on SIGTERM or when
+// leadership is lost.
+func (pe *PodEvictor) SetContext(ctx context.Context) {
+	pe.ctx = ctx
+}
+
+// SetHistory skips pods whose owner was evicted within the history
+// cooldown, and records new evictions into it.
+func (pe *PodEvictor) SetHistory(h *EvictionHistory) {
+	pe.history = h
+}
+
+// SetRecorder records an event on the pod and its node for every eviction
+// and skip decision.
+func (pe *PodEvictor) SetRecorder(r record.EventRecorder) {
+	pe.recorder = r
+}
+
+// SetMaxPods sets the eviction budget of the run, 0 for unlimited.
+func (pe *PodEvictor) SetMaxPods(n int) {
+	pe.maxPods = n
+}
+
+// SetPodDisruptionBudgets makes the evictor respect pdbs, the remaining
+// disruptions are decreased as pods are evicted.
+func (pe *PodEvictor) SetPodDisruptionBudgets(pdbs []*policyvb1.PodDisruptionBudget) {
+	pe.budgets = newDisruptionBudgets(pdbs)
+}
+
+// SetNamespaces makes the evictor honor the eviction annotation of the
+// namespaces.
+func (pe *PodEvictor) SetNamespaces(namespaces []*v1.Namespace) {
+	pe.namespaces = make(map[string]*v1.Namespace, len(namespaces))
+	for _, ns := range namespaces {
+		pe.namespaces[ns.Name] = ns
+	}
+}
+
+// SetPodFilter restricts the pods evicted by all strategies.
+func (pe *PodEvictor) SetPodFilter(f *PodFilter) {
+	pe.filter = f
+}
+
+// NotEvictableReason returns why the pod could not be evicted, with the
+// pod filter and the annotation of its namespace in account, empty if
+// evictable.
+func (pe *PodEvictor) NotEvictableReason(pod *v1.Pod) string {
+	reason, _ := pe.NotEvictable(pod)
+	return reason.Message
+}
+
+// NotEvictable returns why the pod could not be evicted and true, the code
+// is ReasonFilteredOut if the pod filter leaves it out.
+func (pe *PodEvictor) NotEvictable(pod *v1.Pod) (Reason, bool) {
+	if pod == nil {
+		return Reason{ReasonNotEvictable, notEvictableReason(pod, nil)}, true
+	}
+	if pe.filter != nil {
+		if reason := pe.filter.Reason(pod); reason != "" {
+			return Reason{ReasonFilteredOut, reason}, true
+		}
+	}
+	if reason := notEvictableReason(pod, pe.namespaces[pod.Namespace]); reason != "" {
+		return Reason{ReasonNotEvictable, reason}, true
+	}
+	return Reason{}, false
+}
+
+// FilterEvictablePods returns the pods that could be evicted, with the pod
+// filter and the namespace annotations in account.
+func (pe *PodEvictor) FilterEvictablePods(pods []*v1.Pod) []*v1.Pod {
+	var ret []*v1.Pod
+	for _, pod := range pods {
+		if pe.NotEvictableReason(pod) != "" {
+			continue
+		}
+		ret = append(ret, pod)
+	}
+	return ret
+}
+
+// SetStrategy sets the strategy name recorded with following decisions.
+func (pe *PodEvictor) SetStrategy(name string) {
+	pe.strategy = name
+}
+
+func (pe *PodEvictor) DryRun() bool {
+	return pe.dryRun
+}
+
+// Exhausted reports whether the eviction budget is used up.
+func (pe *PodEvictor) Exhausted() bool {
+	return pe.maxPods > 0 && len(pe.evicted) >= pe.maxPods
+}
+
+// Stopped reports whether the run is canceled.
+func (pe *PodEvictor) Stopped() bool {
+	return pe.ctx.Err() != nil
+}
+
+// Done reports whether no more pods may be evicted in this run.
+func (pe *PodEvictor) Done() bool {
+	return pe.Stopped() || pe.Exhausted()
+}
+
+// IsEvicted reports whether the pod was evicted earlier in this run.
+func (pe *PodEvictor) IsEvicted(pod *v1.Pod) bool {
+	_, ok := pe.evictedSet[podKey(pod)]
+	return ok
+}
+
+// Evict evicts the pod, or records it only in dry run mode. ErrPodSkipped
+// is returned if a pdb blocks the eviction.
+func (pe *PodEvictor) Evict(pod *v1.Pod, reason Reason) error {
+	if pe.IsEvicted(pod) {
+		return nil
+	}
+	if pe.Stopped() {
+		return pe.ctx.Err()
+	}
+	if pe.Exhausted() {
+		return ErrEvictionBudgetExceeded
+	}
+	if pe.history != nil && pe.history.InCooldown(pod) {
+		pe.Skip(pod, Reason{ReasonCooldown, "owner evicted recently, in cooldown"})
+		return ErrPodSkipped
+	}
+
+	var matched []*disruptionBudget
+	for _, b := range pe.budgets {
+		if !b.matches(pod) {
+			continue
+		}
+		if b.allowed <= 0 {
+			pe.Skip(pod, Reason{ReasonDisruptionBudget, fmt.Sprintf("would violate PodDisruptionBudget %s", b.name())})
+			return ErrPodSkipped
+		}
+		matched = append(matched, b)
+	}
+
+	if !pe.dryRun {
+		labels := []string{pod.Spec.NodeName, pod.Namespace, pe.strategy, reason.Code}
+		metrics.EvictionsAttempted.WithLabelValues(labels...).Inc()
+		if err := evict(pe.cli, pod); err != nil {
+			metrics.EvictionsFailed.WithLabelValues(labels...).Inc()
+			// blocked by a pdb the evictor does not know about yet
+			if apierrors.IsTooManyRequests(err) {
+				pe.Skip(pod, Reason{ReasonEvictionRejected, fmt.Sprintf("eviction rejected: %v", err)})
+				return ErrPodSkipped
+			}
+			pe.event(pod, v1.EventTypeWarning, Reason{ReasonEvictionFailed, fmt.Sprintf("%s: %v", reason.Message, err)}, "eviction failed")
+			return fmt.Errorf("evict %q failed: %v", pod.Name, err)
+		}
+		metrics.EvictionsSucceeded.WithLabelValues(labels...).Inc()
+	}
+	for _, b := range matched {
+		b.allowed--
+	}
+	if pe.history != nil && !pe.dryRun {
+		pe.history.Record(pod)
+	}
+	log.Printf("evict pod %s/%s from node %s by %s: %s", pod.Namespace, pod.Name, pod.Spec.NodeName, pe.strategy, reason.Message)
+	pe.evictedSet[podKey(pod)] = struct{}{}
+	pe.evicted = append(pe.evicted, pe.record(pod, reason))
+	pe.event(pod, v1.EventTypeNormal, reason, "evicted")
+	return nil
+}
+
+func (pe *PodEvictor) record(pod *v1.Pod, reason Reason) EvictionRecord {
+	return EvictionRecord{Pod: pod, Node: pod.Spec.NodeName, Strategy: pe.strategy, Code: reason.Code, Reason: reason.Message}
+}
+
+// event records the decision on the pod and its node, the recorder
+// aggregates similar events so repeated skips do not flood the api.
+func (pe *PodEvictor) event(pod *v1.Pod, eventType string, reason Reason, action string) {
+	if pe.recorder == nil {
+		return
+	}
+	pe.recorder.Eventf(pod, eventType, reason.Code, "%s by podacrobat %s: %s", action, pe.strategy, reason.Message)
+	if pod.Spec.NodeName == "" {
+		return
+	}
+	node := &v1.ObjectReference{Kind: "Node", Name: pod.Spec.NodeName, UID: k8stypes.UID(pod.Spec.NodeName)}
+	pe.recorder.Eventf(node, eventType, reason.Code, "pod %s %s by podacrobat %s: %s", podKey(pod), action, pe.strategy, reason.Message)
+}
+
+func podKey(pod *v1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+// Evicted returns pods evicted (or would be evicted in dry run mode) so far.
+func (pe *PodEvictor) Evicted() []EvictionRecord {
+	return pe.evicted
+}
+
+// Skip records a candidate pod left in place and why.
+func (pe *PodEvictor) Skip(pod *v1.Pod, reason Reason) {
+	log.Printf("skip pod %s/%s on node %s by %s: %s", pod.Namespace, pod.Name, pod.Spec.NodeName, pe.strategy, reason.Message)
+	pe.skipped = append(pe.skipped, pe.record(pod, reason))
+	// pods left out by the user's filter are not candidates, only logged
+	if reason.Code != ReasonFilteredOut {
+		pe.event(pod, v1.EventTypeNormal, reason, "eviction skipped")
+	}
+}
+
+func (pe *PodEvictor) Skipped() []EvictionRecord {
+	return pe.skipped
+}
+
+// PrintPlan writes the eviction plan, one pod per line.
+func (pe *PodEvictor) PrintPlan(out io.Writer) {
+	if len(pe.evicted) == 0 {
+		fmt.Fprintln(out, "no pods to evict")
+		return
+	}
+	for _, e := range pe.evicted {
+		fmt.Fprintf(out, "%s/%s\t%s\t%s\t%s\n", e.Pod.Namespace, e.Pod.Name, e.Node, e.Strategy, e.Reason)
+	}
+}
@@ -0,0 +1,99 @@
+package resources
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	policyvb1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEvictRecordsEvents(t *testing.T) {
+	pdb := &policyvb1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+		Spec: policyvb1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		},
+	}
+	web, db := genPdbTestPod("web-1", "web"), genPdbTestPod("db-1", "db")
+	recorder := record.NewFakeRecorder(10)
+	pe := NewPodEvictor(fake.NewSimpleClientset(web, db), false)
+	pe.SetStrategy("nodesutil")
+	pe.SetPodDisruptionBudgets([]*policyvb1.PodDisruptionBudget{pdb})
+	pe.SetRecorder(recorder)
+
+	reason := Reason{Code: "NodeOverutilized", Message: "node cpu 80.00%"}
+	if err := pe.Evict(web, reason); err != nil {
+		t.Fatalf("evict web-1 failed: %v", err)
+	}
+	if err := pe.Evict(db, reason); err != ErrPodSkipped {
+		t.Fatalf("expected db-1 skipped, got %v", err)
+	}
+	pe.Skip(db, Reason{Code: ReasonNotEvictable, Message: "pod with local storage"})
+	// pods left out by the filter are not worth an event
+	filter, err := NewPodFilter(nil, []string{"default"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe.SetPodFilter(filter)
+	cache := genPdbTestPod("cache-1", "cache")
+	if _, _, err := EvictPods(pe, []*v1.Pod{cache}, reason, nil); err != nil {
+		t.Fatalf("evict pods failed: %v", err)
+	}
+	if skipped := pe.Skipped(); len(skipped) != 3 || skipped[2].Code != ReasonFilteredOut {
+		t.Errorf("expected cache-1 skipped as filtered out, got %v", skipped)
+	}
+	close(recorder.Events)
+
+	var events []string
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+	// pod and node event for each decision
+	if len(events) != 6 {
+		t.Fatalf("expected 6 events, got %v", events)
+	}
+	for i, want := range []string{"NodeOverutilized", "NodeOverutilized", ReasonDisruptionBudget, ReasonDisruptionBudget, ReasonNotEvictable, ReasonNotEvictable} {
+		if !strings.Contains(events[i], want) || !strings.Contains(events[i], "nodesutil") {
+			t.Errorf("expected event %d with reason %s and strategy, got %q", i, want, events[i])
+		}
+	}
+	if !strings.Contains(events[0], "node cpu 80.00%") {
+		t.Errorf("expected usage in event message, got %q", events[0])
+	}
+}
+
+func TestNotEvictableReasonAnnotation(t *testing.T) {
+	local := genPdbTestPod("local", "web")
+	local.Spec.Volumes = []v1.Volume{{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+	optIn := local.DeepCopy()
+	optIn.Annotations = map[string]string{EvictAnnotation: "true"}
+	optOut := genPdbTestPod("opt-out", "web")
+	optOut.Annotations = map[string]string{EvictAnnotation: "false"}
+	plain := genPdbTestPod("plain", "web")
+
+	pe := NewPodEvictor(fake.NewSimpleClientset(), true)
+	if pe.NotEvictableReason(local) == "" {
+		t.Errorf("expected pod with local storage not evictable")
+	}
+	if reason := pe.NotEvictableReason(optIn); reason != "" {
+		t.Errorf("expected opted in pod evictable, got %q", reason)
+	}
+	if reason := pe.NotEvictableReason(optOut); !strings.Contains(reason, EvictAnnotation) {
+		t.Errorf("expected opted out pod skipped by annotation, got %q", reason)
+	}
+
+	pe.SetNamespaces([]*v1.Namespace{{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Annotations: map[string]string{EvictAnnotation: "false"}},
+	}})
+	if reason := pe.NotEvictableReason(plain); !strings.Contains(reason, "namespace annotation") {
+		t.Errorf("expected pod skipped by namespace annotation, got %q", reason)
+	}
+	// the pod annotation wins over the namespace one
+	if reason := pe.NotEvictableReason(optIn); reason != "" {
+		t.Errorf("expected opted in pod evictable, got %q", reason)
+	}
+}
@@ -0,0 +1,61 @@
+package resources
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PodFilter restricts eviction candidates by namespace and labels, pods
+// filtered out stay in the snapshot and still count for node usage.
+type PodFilter struct {
+	namespaces map[string]struct{}
+	excluded   map[string]struct{}
+	selector   labels.Selector
+}
+
+// NewPodFilter builds a filter, empty namespaces include all of them and
+// an empty selector matches all pods.
+func NewPodFilter(namespaces, excluded []string, selector string) (*PodFilter, error) {
+	f := &PodFilter{
+		namespaces: toSet(namespaces),
+		excluded:   toSet(excluded),
+		selector:   labels.Everything(),
+	}
+	if selector != "" {
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("parse pod selector %q failed: %v", selector, err)
+		}
+		f.selector = s
+	}
+	return f, nil
+}
+
+func toSet(items []string) map[string]struct{} {
+	if len(items) == 0 {
+		return nil
+	}
+	ret := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		ret[item] = struct{}{}
+	}
+	return ret
+}
+
+// Reason returns why the pod is filtered out, empty if it passes.
+func (f *PodFilter) Reason(pod *v1.Pod) string {
+	if f.namespaces != nil {
+		if _, ok := f.namespaces[pod.Namespace]; !ok {
+			return fmt.Sprintf("namespace %q not included", pod.Namespace)
+		}
+	}
+	if _, ok := f.excluded[pod.Namespace]; ok {
+		return fmt.Sprintf("namespace %q excluded", pod.Namespace)
+	}
+	if !f.selector.Matches(labels.Set(pod.Labels)) {
+		return fmt.Sprintf("labels do not match pod selector %q", f.selector.String())
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package resources
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestPodFilter(t *testing.T) {
+	web := genPdbTestPod("web-1", "web")
+	db := genPdbTestPod("db-1", "db")
+	dns := genPdbTestPod("dns", "dns")
+	dns.Namespace = "kube-system"
+
+	tests := []struct {
+		name       string
+		namespaces []string
+		excluded   []string
+		selector   string
+		// whether web, db and dns pass
+		want [3]bool
+	}{
+		{name: "all", want: [3]bool{true, true, true}},
+		{name: "include", namespaces: []string{"default"}, want: [3]bool{true, true, false}},
+		{name: "exclude", excluded: []string{"kube-system"}, want: [3]bool{true, true, false}},
+		{name: "selector", selector: "app in (web,dns)", want: [3]bool{true, false, true}},
+		{name: "exclude and selector", excluded: []string{"kube-system"}, selector: "app!=db", want: [3]bool{true, false, false}},
+	}
+	for _, test := range tests {
+		f, err := NewPodFilter(test.namespaces, test.excluded, test.selector)
+		if err != nil {
+			t.Fatalf("%s: build filter failed: %v", test.name, err)
+		}
+		for i, pod := range []*v1.Pod{web, db, dns} {
+			reason := f.Reason(pod)
+			if (reason == "") != test.want[i] {
+				t.Errorf("%s: expected %s passing %v, got reason %q", test.name, pod.Name, test.want[i], reason)
+			}
+		}
+	}
+
+	if _, err := NewPodFilter(nil, nil, "app in ("); err == nil {
+		t.Errorf("expected illegal selector rejected")
+	}
+}
@@ -0,0 +1,64 @@
+package resources
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// EvictionHistory remembers evictions across runs in controller mode, so
+// the replacement of an evicted pod is not moved again right away.
+type EvictionHistory struct {
+	mu       sync.Mutex
+	cooldown time.Duration
+	evicted  map[string]time.Time
+	now      func() time.Time
+}
+
+func NewEvictionHistory(cooldown time.Duration) *EvictionHistory {
+	return &EvictionHistory{
+		cooldown: cooldown,
+		evicted:  make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// InCooldown reports whether the owner of the pod, or the pod itself if it
+// has no owner, was evicted within the cooldown.
+func (h *EvictionHistory) InCooldown(pod *v1.Pod) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range historyKeys(pod) {
+		if t, ok := h.evicted[key]; ok && h.now().Sub(t) < h.cooldown {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *EvictionHistory) Record(pod *v1.Pod) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	for _, key := range historyKeys(pod) {
+		h.evicted[key] = now
+	}
+	// drop expired entries
+	for key, t := range h.evicted {
+		if now.Sub(t) >= h.cooldown {
+			delete(h.evicted, key)
+		}
+	}
+}
+
+func historyKeys(pod *v1.Pod) []string {
+	if len(pod.OwnerReferences) == 0 {
+		return []string{podKey(pod)}
+	}
+	var ret []string
+	for _, ref := range pod.OwnerReferences {
+		ret = append(ret, string(ref.UID))
+	}
+	return ret
+}
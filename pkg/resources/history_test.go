@@ -0,0 +1,77 @@
+package resources
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEvictionHistoryCooldown(t *testing.T) {
+	now := time.Now()
+	h := NewEvictionHistory(time.Hour)
+	h.now = func() time.Time { return now }
+
+	web1, web2, db := genPdbTestPod("web-1", "web"), genPdbTestPod("web-2", "web"), genPdbTestPod("db-1", "db")
+	// same owner as web-1
+	web2.OwnerReferences = web1.OwnerReferences
+	orphan := genPdbTestPod("orphan", "orphan")
+	orphan.OwnerReferences = nil
+
+	h.Record(web1)
+	h.Record(orphan)
+	for _, test := range []struct {
+		pod      *v1.Pod
+		cooldown bool
+	}{
+		{pod: web1, cooldown: true},
+		{pod: web2, cooldown: true},
+		{pod: db},
+		{pod: orphan, cooldown: true},
+	} {
+		if got := h.InCooldown(test.pod); got != test.cooldown {
+			t.Errorf("pod %s: expected cooldown %v, got %v", test.pod.Name, test.cooldown, got)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	if h.InCooldown(web2) || h.InCooldown(orphan) {
+		t.Errorf("expected cooldown expired after an hour")
+	}
+	// expired entries are dropped on the next record
+	h.Record(db)
+	if len(h.evicted) != 1 {
+		t.Errorf("expected only db-1 owner kept, got %v", h.evicted)
+	}
+}
+
+func TestEvictSkipsCooldown(t *testing.T) {
+	now := time.Now()
+	h := NewEvictionHistory(time.Hour)
+	h.now = func() time.Time { return now }
+
+	web1, web2 := genPdbTestPod("web-1", "web"), genPdbTestPod("web-2", "web")
+	web2.OwnerReferences = web1.OwnerReferences
+	pe := NewPodEvictor(fake.NewSimpleClientset(web1, web2), false)
+	pe.SetHistory(h)
+
+	reason := Reason{Code: "Test", Message: "test"}
+	if err := pe.Evict(web1, reason); err != nil {
+		t.Fatalf("evict web-1 failed: %v", err)
+	}
+	// the replacement of web-1 in the next run
+	next := NewPodEvictor(fake.NewSimpleClientset(web2), false)
+	next.SetHistory(h)
+	if err := next.Evict(web2, reason); err != ErrPodSkipped {
+		t.Fatalf("expected web-2 skipped in cooldown, got %v", err)
+	}
+	if skipped := next.Skipped(); len(skipped) != 1 || skipped[0].Code != ReasonCooldown {
+		t.Errorf("expected web-2 skipped for cooldown, got %v", skipped)
+	}
+
+	now = now.Add(time.Hour)
+	if err := next.Evict(web2, reason); err != nil {
+		t.Errorf("expected web-2 evicted after the cooldown, got %v", err)
+	}
+}
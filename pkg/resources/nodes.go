@@ -1,117 +1,54 @@
 package resources
 
 import (
-	"context"
-	"errors"
-	"fmt"
-
-	"k8s.io/apimachinery/pkg/fields"
-
 	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
-var ErrListNodesTimeout = errors.New("list nodes timeout")
-var ErrListNodePodsTimeout = errors.New("list node pods timeout")
-
-func ListNodes(ctx context.Context, cli clientset.Interface) ([]*v1.Node, error) {
-	type result struct {
-		nodes []*v1.Node
-		err   error
-	}
-	c := make(chan result, 1)
-
-	go func(ctx context.Context) {
-		nodes, err := listNodes(cli)
-		result := result{nodes, err}
-		select {
-		case c <- result:
-		case <-ctx.Done():
-		}
-	}(ctx)
-
-	select {
-	case <-ctx.Done():
-		return nil, ErrListNodesTimeout
-	case ret := <-c:
-		return ret.nodes, ret.err
-	}
-}
-
-func listNodes(cli clientset.Interface) ([]*v1.Node, error) {
-	items, err := cli.CoreV1().Nodes().List(metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("list nodes failed: %v", err)
-	}
-	if items == nil || len(items.Items) == 0 {
-		return nil, nil
-	}
-
-	var ret []*v1.Node
-	for _, node := range items.Items {
-		node := node
-		ret = append(ret, &node)
-	}
-
-	return filterReady(ret), nil
-}
-
-func filterReady(nodes []*v1.Node) []*v1.Node {
-	var ret []*v1.Node
-
-	for _, node := range nodes {
-		var notReady bool
-		for _, status := range node.Status.Conditions {
-			if status.Type != v1.NodeReady {
-				notReady = true
-				break
+// RemoveEvictedPods returns a copy of the snapshot without pods evicted
+// so far, so following strategies see the cluster after the evictions.
+// The removed pods are kept in Evicted.
+func RemoveEvictedPods(nodePods map[string]NodeInfoWithPods, pe *PodEvictor) map[string]NodeInfoWithPods {
+	ret := make(map[string]NodeInfoWithPods, len(nodePods))
+	for name, info := range nodePods {
+		var pods []*v1.Pod
+		evicted := append([]*v1.Pod(nil), info.Evicted...)
+		for _, pod := range info.Pods {
+			if pe.IsEvicted(pod) {
+				evicted = append(evicted, pod)
+				continue
 			}
+			pods = append(pods, pod)
 		}
-		if notReady {
-			continue
-		}
-		ret = append(ret, node)
+		ret[name] = NodeInfoWithPods{Node: info.Node, Pods: pods, Evicted: evicted}
 	}
-
 	return ret
 }
 
-func GroupPodsByNode(cli clientset.Interface, nodes []*v1.Node) (map[string]NodeInfoWithPods, error) {
-	ret := make(map[string]NodeInfoWithPods)
-
-	for _, node := range nodes {
-		pods, err := listNodePods(cli, node)
-		if err != nil {
-			return nil, fmt.Errorf("list pods on node %q faild: %v", node.Name, err)
-		}
-		ret[node.Name] = NodeInfoWithPods{Node: node, Pods: pods}
-	}
-
-	return ret, nil
-}
-
-func listNodePods(cli clientset.Interface, node *v1.Node) ([]*v1.Pod, error) {
-	sstr := fmt.Sprintf(`spec.nodeName=%s,status.phase=%s||status.phase\=%s`, "node1", "Pending", "Running")
-	selector, err := fields.ParseSelector(sstr)
-	if err != nil {
-		return nil, fmt.Errorf("parse pod selector failed: %v", err)
+// GroupNodesByLabel splits the snapshot by the value of the node label,
+// nodes without the label make up the "" group. An empty label returns
+// the whole snapshot as one group.
+func GroupNodesByLabel(nodePods map[string]NodeInfoWithPods, label string) map[string]map[string]NodeInfoWithPods {
+	if label == "" {
+		return map[string]map[string]NodeInfoWithPods{"": nodePods}
 	}
-
-	pods, err := cli.CoreV1().Pods("").List(metav1.ListOptions{FieldSelector: selector.String()})
-
-	var ret []*v1.Pod
-	for _, pod := range pods.Items {
-		pod := pod
-		ret = append(ret, &pod)
+	ret := make(map[string]map[string]NodeInfoWithPods)
+	for name, info := range nodePods {
+		value := info.Node.Labels[label]
+		if ret[value] == nil {
+			ret[value] = make(map[string]NodeInfoWithPods)
+		}
+		ret[value][name] = info
 	}
-
-	return ret, nil
+	return ret
 }
 
 type NodeInfoWithPods struct {
 	Node *v1.Node
 	Pods []*v1.Pod
+	// pods evicted by earlier policies of the pass, node usage samples
+	// taken before still count them
+	Evicted []*v1.Pod
 }
 
 func (n *NodeInfoWithPods) BestEffortPods() []*v1.Pod {
@@ -136,32 +73,69 @@ func (n *NodeInfoWithPods) BurstablePods() []*v1.Pod {
 	return ret
 }
 
-func IsIdleNode(usage, capacity v1.ResourceList, cpuThreshold, memThreshold float64) bool {
-	cpu, mem := UsagePercentage(usage, capacity)
+// denominators of usage percentages
+const (
+	BasisAllocatable = "allocatable"
+	BasisCapacity    = "capacity"
+)
 
-	if cpu > cpuThreshold || mem > memThreshold {
-		return false
+// NodeResources returns the node resources usage percentages are relative
+// to, allocatable leaves out system and kube reserved like the scheduler.
+func NodeResources(node *v1.Node, basis string) v1.ResourceList {
+	// allocatable may be unset by old kubelets
+	if basis == BasisCapacity || len(node.Status.Allocatable) == 0 {
+		return node.Status.Capacity
 	}
+	return node.Status.Allocatable
+}
 
+// IsIdleNode reports whether usage of every resource with a threshold is
+// at most the threshold, percentages of capacity.
+func IsIdleNode(usage, capacity v1.ResourceList, thresholds map[v1.ResourceName]float64) bool {
+	for name, threshold := range thresholds {
+		if ResourceUsagePercentage(name, usage, capacity) > threshold {
+			return false
+		}
+	}
 	return true
 }
 
-func IsEvictNode(usage, capacity v1.ResourceList, cpuThreshold, memThreshold float64) bool {
-	cpu, mem := UsagePercentage(usage, capacity)
-
-	if cpu < cpuThreshold || mem < memThreshold {
-		return false
+// IsEvictNode reports whether usage of every resource with a threshold
+// reaches the threshold, or of any if matchAll is false, percentages of
+// capacity. Resources the node does not have are left out.
+func IsEvictNode(usage, capacity v1.ResourceList, thresholds map[v1.ResourceName]float64, matchAll bool) bool {
+	var matched bool
+	for name, threshold := range thresholds {
+		if _, ok := capacity[name]; !ok {
+			continue
+		}
+		reached := ResourceUsagePercentage(name, usage, capacity) >= threshold
+		if reached && !matchAll {
+			return true
+		}
+		if !reached && matchAll {
+			return false
+		}
+		matched = matched || reached
 	}
+	return matched
+}
 
-	return true
+// ResourceUsagePercentage returns the usage percentage of one resource,
+// 0 if the node has none of it.
+func ResourceUsagePercentage(name v1.ResourceName, usage, capacity v1.ResourceList) float64 {
+	c := ResourceAmount(name, capacity[name])
+	if c <= 0 {
+		return 0
+	}
+	return ResourceAmount(name, usage[name]) * 100 / c
 }
 
-func UsagePercentage(usage, capacity v1.ResourceList) (float64, float64) {
-	cpuUsag := usage[v1.ResourceCPU]
-	memUsage := usage[v1.ResourceMemory]
-	cpuCapacity := capacity[v1.ResourceCPU]
-	memCapacity := capacity[v1.ResourceMemory]
-	cpu := float64(cpuUsag.MilliValue()) * 100 / float64(cpuCapacity.MilliValue())
-	mem := float64(memUsage.Value()) * 100 / float64(memCapacity.Value())
-	return cpu, mem
+// ResourceAmount returns the quantity in the unit the resource is measured,
+// millicores for cpu, plain values for others.
+func ResourceAmount(name v1.ResourceName, q resource.Quantity) float64 {
+	if name == v1.ResourceCPU {
+		return float64(q.MilliValue())
+	}
+	return float64(q.Value())
 }
@@ -0,0 +1,43 @@
+package resources
+
+import (
+	v1 "k8s.io/api/core/v1"
+	policyvb1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// disruptionBudget tracks the disruptions a pdb still allows in this run.
+type disruptionBudget struct {
+	pdb      *policyvb1.PodDisruptionBudget
+	selector labels.Selector
+	allowed  int32
+}
+
+func newDisruptionBudgets(pdbs []*policyvb1.PodDisruptionBudget) []*disruptionBudget {
+	var ret []*disruptionBudget
+	for _, pdb := range pdbs {
+		// nil or empty selector matches no pods for policy/v1beta1
+		if pdb.Spec.Selector == nil || len(pdb.Spec.Selector.MatchLabels)+len(pdb.Spec.Selector.MatchExpressions) == 0 {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, &disruptionBudget{
+			pdb:      pdb,
+			selector: selector,
+			allowed:  pdb.Status.PodDisruptionsAllowed,
+		})
+	}
+	return ret
+}
+
+func (b *disruptionBudget) matches(pod *v1.Pod) bool {
+	return b.pdb.Namespace == pod.Namespace && b.selector.Matches(labels.Set(pod.Labels))
+}
+
+func (b *disruptionBudget) name() string {
+	return b.pdb.Namespace + "/" + b.pdb.Name
+}
@@ -0,0 +1,87 @@
+package resources
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	policyvb1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestEvictRespectsPodDisruptionBudget(t *testing.T) {
+	pdb := &policyvb1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: policyvb1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		},
+		Status: policyvb1.PodDisruptionBudgetStatus{PodDisruptionsAllowed: 1},
+	}
+	pods := []*v1.Pod{
+		genPdbTestPod("web-1", "web"),
+		genPdbTestPod("web-2", "web"),
+		genPdbTestPod("db-1", "db"),
+	}
+
+	var evictions int
+	fakeCli := &fake.Clientset{}
+	fakeCli.Fake.AddReactor("post", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		evictions++
+		return true, nil, nil
+	})
+
+	pe := NewPodEvictor(fakeCli, false)
+	pe.SetPodDisruptionBudgets([]*policyvb1.PodDisruptionBudget{pdb})
+	evicted, _, err := EvictPods(pe, pods, Reason{Code: "Test", Message: "test"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 2 || evictions != 2 {
+		t.Errorf("expected 2 pods evicted, got %d, api called %d times", len(evicted), evictions)
+	}
+	if len(pe.Skipped()) != 1 || pe.Skipped()[0].Pod.Name != "web-2" {
+		t.Errorf("expected web-2 skipped by pdb, got %v", pe.Skipped())
+	}
+}
+
+func TestEvictSkipsTooManyRequests(t *testing.T) {
+	pods := []*v1.Pod{genPdbTestPod("web-1", "web"), genPdbTestPod("db-1", "db")}
+
+	fakeCli := &fake.Clientset{}
+	fakeCli.Fake.AddReactor("post", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.(clienttesting.GetAction).GetName() == "web-1" {
+			return true, nil, apierrors.NewTooManyRequests("disruption budget", 0)
+		}
+		return true, nil, nil
+	})
+
+	pe := NewPodEvictor(fakeCli, false)
+	evicted, _, err := EvictPods(pe, pods, Reason{Code: "Test", Message: "test"}, nil)
+	if err != nil {
+		t.Fatalf("429 should not fail the run: %v", err)
+	}
+	if len(evicted) != 1 || evicted[0].Name != "db-1" {
+		t.Errorf("expected db-1 evicted, got %v", evicted)
+	}
+	if len(pe.Skipped()) != 1 {
+		t.Errorf("expected web-1 skipped, got %v", pe.Skipped())
+	}
+}
+
+func genPdbTestPod(name, app string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Labels:    map[string]string{"app": app},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: name, UID: k8stypes.UID("uid-" + name)},
+			},
+		},
+		Spec: v1.PodSpec{NodeName: "test-node-1"},
+	}
+}
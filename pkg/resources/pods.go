@@ -14,41 +14,74 @@ import (
 	k8sresource "k8s.io/kubernetes/pkg/api/v1/resource"
 )
 
-func Evictable(pod *v1.Pod) bool {
+// EvictAnnotation on a pod or namespace opts out of eviction with "false",
+// "true" opts in pods with local storage. The pod annotation wins.
+const EvictAnnotation = "podacrobat.io/evict"
+
+// notEvictableReason returns why the pod could not be evicted, empty if
+// evictable. The annotation of the pod wins over the one of ns.
+func notEvictableReason(pod *v1.Pod, ns *v1.Namespace) string {
 	// check local mount & DaemonSet only
 	if pod == nil {
-		return false
+		return "nil pod"
 	}
 
-	for _, vol := range pod.Spec.Volumes {
-		if vol.EmptyDir != nil || vol.HostPath != nil {
-			return false
+	value, source := evictAnnotation(pod, ns)
+	if value == "false" {
+		return fmt.Sprintf("opted out by %s annotation %s=false", source, EvictAnnotation)
+	}
+
+	if value != "true" {
+		for _, vol := range pod.Spec.Volumes {
+			if vol.EmptyDir != nil || vol.HostPath != nil {
+				return fmt.Sprintf("local storage volume %q", vol.Name)
+			}
 		}
 	}
 
 	for _, ref := range pod.ObjectMeta.GetOwnerReferences() {
 		if ref.Kind == "DaemonSet" {
-			return false
+			return "owned by DaemonSet"
 		}
 	}
 
 	// ignore pods from kube-system
 	if types.IsCriticalPod(pod) {
-		return false
+		return "critical pod"
 	}
 
-	return true
+	return ""
 }
 
-func FilterEvictablePods(pods []*v1.Pod) []*v1.Pod {
-	var ret []*v1.Pod
-	for _, pod := range pods {
-		if !Evictable(pod) {
-			continue
+// evictAnnotation returns the eviction annotation value of the pod, or of
+// its namespace if the pod has none, and where it was found.
+func evictAnnotation(pod *v1.Pod, ns *v1.Namespace) (string, string) {
+	if value, ok := pod.Annotations[EvictAnnotation]; ok {
+		return value, "pod"
+	}
+	if ns != nil {
+		if value, ok := ns.Annotations[EvictAnnotation]; ok {
+			return value, "namespace"
 		}
-		ret = append(ret, pod)
 	}
-	return ret
+	return "", ""
+}
+
+// IsSystemPod reports whether the pod runs cluster infrastructure, pods in
+// kube-system, DaemonSet, static and critical pods.
+func IsSystemPod(pod *v1.Pod) bool {
+	if pod.Namespace == metav1.NamespaceSystem {
+		return true
+	}
+	if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+		return true
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return types.IsCriticalPod(pod)
 }
 
 func IsBestEffortPod(pod *v1.Pod) bool {
@@ -59,7 +92,7 @@ func IsBurstablePod(pod *v1.Pod) bool {
 	return qos.GetPodQOS(pod) == v1.PodQOSBurstable
 }
 
-func Evict(cli clientset.Interface, pod *v1.Pod) error {
+func evict(cli clientset.Interface, pod *v1.Pod) error {
 	ev := policyvb1.Eviction{
 		TypeMeta: metav1.TypeMeta{
 			Kind: "Eviction",
@@ -70,20 +103,25 @@ func Evict(cli clientset.Interface, pod *v1.Pod) error {
 		},
 		DeleteOptions: &metav1.DeleteOptions{},
 	}
-	err := cli.PolicyV1beta1().Evictions(ev.Namespace).Evict(&ev)
-	if err != nil {
-		return fmt.Errorf("evict %q failed: %v", err)
-	}
-	return nil
+	return cli.PolicyV1beta1().Evictions(ev.Namespace).Evict(&ev)
 }
 
-func EvictPods(cli clientset.Interface, pods []*v1.Pod, ownerRefsSet map[string]struct{}) ([]*v1.Pod, map[string]struct{}, error) {
+func EvictPods(pe *PodEvictor, pods []*v1.Pod, reason Reason, ownerRefsSet map[string]struct{}) ([]*v1.Pod, map[string]struct{}, error) {
 	if ownerRefsSet == nil {
 		ownerRefsSet = make(map[string]struct{})
 	}
-	pods = FilterEvictablePods(pods)
 	var evicted []*v1.Pod
 	for _, pod := range pods {
+		if pe.Done() {
+			break
+		}
+		if pe.IsEvicted(pod) {
+			continue
+		}
+		if skip, ok := pe.NotEvictable(pod); ok {
+			pe.Skip(pod, skip)
+			continue
+		}
 		var refSeen bool
 		for _, ref := range pod.OwnerReferences {
 			if _, ok := ownerRefsSet[string(ref.UID)]; ok {
@@ -93,9 +131,13 @@ func EvictPods(cli clientset.Interface, pods []*v1.Pod, ownerRefsSet map[string]
 		}
 		// evict one pod for the same owner reference
 		if refSeen {
+			pe.Skip(pod, Reason{ReasonOwnerEvicted, "another pod of the same owner already evicted"})
+			continue
+		}
+		err := pe.Evict(pod, reason)
+		if err == ErrPodSkipped {
 			continue
 		}
-		err := Evict(cli, pod)
 		if err != nil {
 			return nil, ownerRefsSet, err
 		}
@@ -109,15 +151,32 @@ func EvictPods(cli clientset.Interface, pods []*v1.Pod, ownerRefsSet map[string]
 	return evicted, ownerRefsSet, nil
 }
 
-func EvictTargetQuantityPods(cli clientset.Interface, pods []*v1.Pod,
-	targetCpu, targetMem float64, ownerRefsSet map[string]struct{}) ([]*v1.Pod, map[string]struct{}, error) {
+// EvictTargetQuantityPods evicts pods until the target amount measured by
+// usage is freed for any resource, or for every resource if untilAll is set,
+// see ResourceAmount for the units. Only pods the placer finds a destination
+// for are evicted if it is set.
+func EvictTargetQuantityPods(pe *PodEvictor, pods []*v1.Pod, reason Reason, placer Placer, usage UsageSource,
+	target map[v1.ResourceName]float64, untilAll bool, ownerRefsSet map[string]struct{}) ([]*v1.Pod, map[string]struct{}, error) {
 
 	if ownerRefsSet == nil {
 		ownerRefsSet = make(map[string]struct{})
 	}
-	pods = FilterEvictablePods(pods)
+	remaining := make(map[v1.ResourceName]float64, len(target))
+	for name, amount := range target {
+		remaining[name] = amount
+	}
 	var evicted []*v1.Pod
 	for _, pod := range pods {
+		if pe.Done() || targetMet(remaining, untilAll) {
+			break
+		}
+		if pe.IsEvicted(pod) {
+			continue
+		}
+		if skip, ok := pe.NotEvictable(pod); ok {
+			pe.Skip(pod, skip)
+			continue
+		}
 		var refSeen bool
 		for _, ref := range pod.OwnerReferences {
 			if _, ok := ownerRefsSet[string(ref.UID)]; ok {
@@ -127,40 +186,67 @@ func EvictTargetQuantityPods(cli clientset.Interface, pods []*v1.Pod,
 		}
 		// evict one pod for the same owner reference
 		if refSeen {
+			pe.Skip(pod, Reason{ReasonOwnerEvicted, "another pod of the same owner already evicted"})
+			continue
+		}
+		podReason := reason
+		var dest string
+		if placer != nil {
+			var skip string
+			dest, skip = placer.Place(pod)
+			if dest == "" {
+				pe.Skip(pod, Reason{ReasonNoDestination, skip})
+				continue
+			}
+			podReason.Message = fmt.Sprintf("%s, simulated destination %s", reason.Message, dest)
+		}
+		err := pe.Evict(pod, podReason)
+		if err != nil && dest != "" {
+			placer.Unreserve(pod, dest)
+		}
+		if err == ErrPodSkipped {
 			continue
 		}
-		err := Evict(cli, pod)
 		if err != nil {
 			return nil, ownerRefsSet, err
 		}
 		evicted = append(evicted, pod)
 
-		targetCpu -= float64(k8sresource.GetResourceRequest(pod, v1.ResourceCPU))
-		targetMem -= float64(k8sresource.GetResourceRequest(pod, v1.ResourceMemory))
-		if targetCpu <= 0 || targetMem <= 0 {
-			break
+		podUsage := usage.PodUsage(pod)
+		for name := range remaining {
+			remaining[name] -= ResourceAmount(name, podUsage[name])
 		}
 	}
 	return evicted, ownerRefsSet, nil
 }
 
-func PodsCpuMemRequest(pods []*v1.Pod) v1.ResourceList {
-	ret := make(map[v1.ResourceName]apimresource.Quantity)
+func targetMet(remaining map[v1.ResourceName]float64, all bool) bool {
+	if len(remaining) == 0 {
+		return true
+	}
+	for _, amount := range remaining {
+		if all && amount > 0 {
+			return false
+		}
+		if !all && amount <= 0 {
+			return true
+		}
+	}
+	return all
+}
 
+// PodsRequest sums the requests of pods for every resource, v1.ResourcePods
+// counts the pods.
+func PodsRequest(pods []*v1.Pod) v1.ResourceList {
+	ret := make(v1.ResourceList)
 	for _, pod := range pods {
-		requestResource, _ := k8sresource.PodRequestsAndLimits(pod)
-		for resourceName, qty := range requestResource {
-			if resourceName != v1.ResourceCPU && resourceName != v1.ResourceMemory {
-				continue
-			}
-			v, ok := ret[resourceName]
-			if !ok {
-				ret[resourceName] = qty
-				continue
-			}
+		requests, _ := k8sresource.PodRequestsAndLimits(pod)
+		for name, qty := range requests {
+			v := ret[name].DeepCopy()
 			v.Add(qty)
-			ret[resourceName] = v
+			ret[name] = v
 		}
 	}
-	return v1.ResourceList(ret)
+	ret[v1.ResourcePods] = *apimresource.NewQuantity(int64(len(pods)), apimresource.DecimalSI)
+	return ret
 }
@@ -0,0 +1,148 @@
+package resources
+
+import (
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// PodMatchesNodeSelectorAndAffinity checks nodeSelector and required node
+// affinity of the pod against the node labels.
+func PodMatchesNodeSelectorAndAffinity(pod *v1.Pod, node *v1.Node) bool {
+	if len(pod.Spec.NodeSelector) > 0 {
+		if !labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+			return false
+		}
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil {
+		return true
+	}
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil {
+		return true
+	}
+	return MatchNodeSelectorTerms(required.NodeSelectorTerms, node)
+}
+
+// MatchNodeSelectorTerms reports whether any of the terms matches the node,
+// terms are ORed, requirements inside a term are ANDed.
+func MatchNodeSelectorTerms(terms []v1.NodeSelectorTerm, node *v1.Node) bool {
+	for _, term := range terms {
+		// an empty term matches no objects
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		if !matchRequirements(term.MatchExpressions, labels.Set(node.Labels)) {
+			continue
+		}
+		if !matchFields(term.MatchFields, node) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// matchFields matches the node name, the only supported field. It is not a
+// label, label requirements reject names longer than 63 characters.
+func matchFields(reqs []v1.NodeSelectorRequirement, node *v1.Node) bool {
+	for _, req := range reqs {
+		if req.Key != "metadata.name" {
+			return false
+		}
+		var in bool
+		for _, value := range req.Values {
+			if value == node.Name {
+				in = true
+				break
+			}
+		}
+		switch req.Operator {
+		case v1.NodeSelectorOpIn:
+			if !in {
+				return false
+			}
+		case v1.NodeSelectorOpNotIn:
+			if in {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func matchRequirements(reqs []v1.NodeSelectorRequirement, set labels.Set) bool {
+	for _, req := range reqs {
+		var op selection.Operator
+		switch req.Operator {
+		case v1.NodeSelectorOpIn:
+			op = selection.In
+		case v1.NodeSelectorOpNotIn:
+			op = selection.NotIn
+		case v1.NodeSelectorOpExists:
+			op = selection.Exists
+		case v1.NodeSelectorOpDoesNotExist:
+			op = selection.DoesNotExist
+		case v1.NodeSelectorOpGt:
+			op = selection.GreaterThan
+		case v1.NodeSelectorOpLt:
+			op = selection.LessThan
+		default:
+			return false
+		}
+		r, err := labels.NewRequirement(req.Key, op, req.Values)
+		if err != nil {
+			return false
+		}
+		if !r.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// PodToleratesNodeTaints checks NoSchedule and NoExecute taints only.
+func PodToleratesNodeTaints(pod *v1.Pod, node *v1.Node) bool {
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute {
+			continue
+		}
+		var tolerated bool
+		for j := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// PodHostPorts returns the host ports the pod claims, keyed by protocol/port.
+func PodHostPorts(pod *v1.Pod) []string {
+	var ret []string
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.HostPort <= 0 {
+				continue
+			}
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = v1.ProtocolTCP
+			}
+			ret = append(ret, fmt.Sprintf("%s/%s", protocol, strconv.Itoa(int(p.HostPort))))
+		}
+	}
+	return ret
+}
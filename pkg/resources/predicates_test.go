@@ -0,0 +1,34 @@
+package resources
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMatchNodeSelectorTermsFields(t *testing.T) {
+	// fqdn node names often exceed the 63 characters of label values
+	name := "ip-10-0-1-23." + strings.Repeat("a", 50) + ".compute.internal"
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"disk": "ssd"}}}
+
+	for i, test := range []struct {
+		req   v1.NodeSelectorRequirement
+		match bool
+	}{
+		{req: v1.NodeSelectorRequirement{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{name}}, match: true},
+		{req: v1.NodeSelectorRequirement{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"other"}}},
+		{req: v1.NodeSelectorRequirement{Key: "metadata.name", Operator: v1.NodeSelectorOpNotIn, Values: []string{name}}},
+		{req: v1.NodeSelectorRequirement{Key: "metadata.name", Operator: v1.NodeSelectorOpNotIn, Values: []string{"other"}}, match: true},
+		{req: v1.NodeSelectorRequirement{Key: "metadata.uid", Operator: v1.NodeSelectorOpIn, Values: []string{name}}},
+	} {
+		terms := []v1.NodeSelectorTerm{{
+			MatchExpressions: []v1.NodeSelectorRequirement{{Key: "disk", Operator: v1.NodeSelectorOpIn, Values: []string{"ssd"}}},
+			MatchFields:      []v1.NodeSelectorRequirement{test.req},
+		}}
+		if got := MatchNodeSelectorTerms(terms, node); got != test.match {
+			t.Errorf("case %d: expected match %v, got %v", i, test.match, got)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyvb1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var ErrCacheSyncTimeout = errors.New("wait for cache sync timeout")
+
+const nodeNameIndex = "spec.nodeName"
+
+// terminated pods do not use node resources, keep them out of the cache
+const activePodsSelector = "status.phase!=" + string(v1.PodSucceeded) + ",status.phase!=" + string(v1.PodFailed)
+
+// Snapshotter serves node and pod snapshots from shared informers, one
+// cluster-wide list and watch per resource no matter how many nodes or
+// passes. Objects in a snapshot are shared with the cache, never modify them.
+type Snapshotter struct {
+	factory    informers.SharedInformerFactory
+	nodeLister corelisters.NodeLister
+	podIndexer cache.Indexer
+	pdbLister  policylisters.PodDisruptionBudgetLister
+	nsLister   corelisters.NamespaceLister
+	synced     []cache.InformerSynced
+}
+
+func NewSnapshotter(cli clientset.Interface) *Snapshotter {
+	factory := informers.NewSharedInformerFactory(cli, 0)
+	nodes := factory.Core().V1().Nodes()
+	pods := factory.InformerFor(&v1.Pod{}, newPodInformer)
+	pdbs := factory.Policy().V1beta1().PodDisruptionBudgets()
+	namespaces := factory.Core().V1().Namespaces()
+
+	return &Snapshotter{
+		factory:    factory,
+		nodeLister: nodes.Lister(),
+		podIndexer: pods.GetIndexer(),
+		pdbLister:  pdbs.Lister(),
+		nsLister:   namespaces.Lister(),
+		synced: []cache.InformerSynced{
+			nodes.Informer().HasSynced,
+			pods.HasSynced,
+			pdbs.Informer().HasSynced,
+			namespaces.Informer().HasSynced,
+		},
+	}
+}
+
+func newPodInformer(cli clientset.Interface, resync time.Duration) cache.SharedIndexInformer {
+	indexers := cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		nodeNameIndex:        podNodeName,
+	}
+	return coreinformers.NewFilteredPodInformer(cli, metav1.NamespaceAll, resync, indexers, func(opts *metav1.ListOptions) {
+		opts.FieldSelector = activePodsSelector
+	})
+}
+
+func podNodeName(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+// Start runs the informers until ctx is done and waits for the first
+// list to land in the cache, at most timeout.
+func (s *Snapshotter) Start(ctx context.Context, timeout time.Duration) error {
+	s.factory.Start(ctx.Done())
+
+	syncCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), s.synced...) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrCacheSyncTimeout
+	}
+	return nil
+}
+
+// Snapshot groups the active, not terminating pods of nodes matching the selector by node
+// name, see FilterEligibleNodes to drop the nodes not fit for balancing.
+func (s *Snapshotter) Snapshot(nodeSelector labels.Selector) (map[string]NodeInfoWithPods, error) {
+	nodes, err := s.nodeLister.List(nodeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("list nodes failed: %v", err)
+	}
+
+	ret := make(map[string]NodeInfoWithPods)
+	for _, node := range nodes {
+		objs, err := s.podIndexer.ByIndex(nodeNameIndex, node.Name)
+		if err != nil {
+			return nil, fmt.Errorf("list pods on node %q failed: %v", node.Name, err)
+		}
+		var pods []*v1.Pod
+		for _, obj := range objs {
+			pod := obj.(*v1.Pod)
+			// the field selector may be ignored, e.g. by fake clients
+			if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+				continue
+			}
+			// terminating pods are already on their way out, evicting them
+			// again is pointless and they free their resources soon
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			pods = append(pods, pod)
+		}
+		ret[node.Name] = NodeInfoWithPods{Node: node, Pods: pods}
+	}
+	return ret, nil
+}
+
+func (s *Snapshotter) PodDisruptionBudgets() ([]*policyvb1.PodDisruptionBudget, error) {
+	pdbs, err := s.pdbLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("list pod disruption budgets failed: %v", err)
+	}
+	return pdbs, nil
+}
+
+func (s *Snapshotter) Namespaces() ([]*v1.Namespace, error) {
+	namespaces, err := s.nsLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces failed: %v", err)
+	}
+	return namespaces, nil
+}
@@ -0,0 +1,77 @@
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSnapshot(t *testing.T) {
+	ready := []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	node1 := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Status: v1.NodeStatus{Conditions: ready}}
+	node2 := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"pool": "gpu"}},
+		Status:     v1.NodeStatus{Conditions: ready},
+	}
+	done := genSnapshotTestPod("done", "node1", v1.PodSucceeded)
+	terminating := genSnapshotTestPod("terminating", "node1", v1.PodRunning)
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	fakeCli := fake.NewSimpleClientset(node1, node2,
+		genSnapshotTestPod("a", "node1", v1.PodRunning),
+		genSnapshotTestPod("b", "node1", v1.PodPending),
+		genSnapshotTestPod("c", "node2", v1.PodRunning),
+		genSnapshotTestPod("unscheduled", "", v1.PodPending),
+		done, terminating)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewSnapshotter(fakeCli)
+	if err := s.Start(ctx, 10*time.Second); err != nil {
+		t.Fatalf("start snapshotter failed: %v", err)
+	}
+	listCalls := len(fakeCli.Actions())
+
+	nodePods, err := s.Snapshot(labels.Everything())
+	if err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	if len(nodePods) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(nodePods))
+	}
+	if n := len(nodePods["node1"].Pods); n != 2 {
+		t.Errorf("expected 2 active pods on node1, got %d", n)
+	}
+	if n := len(nodePods["node2"].Pods); n != 1 {
+		t.Errorf("expected 1 pod on node2, got %d", n)
+	}
+	if len(fakeCli.Actions()) != listCalls {
+		t.Errorf("snapshot should be served from cache, got actions %v", fakeCli.Actions()[listCalls:])
+	}
+
+	groups := GroupNodesByLabel(nodePods, "pool")
+	if len(groups) != 2 || len(groups["gpu"]) != 1 || len(groups[""]) != 1 {
+		t.Errorf("expected node2 in gpu group and node1 in unlabeled group, got %v", groups)
+	}
+
+	selector, _ := labels.Parse("pool!=gpu")
+	nodePods, err = s.Snapshot(selector)
+	if err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	if _, ok := nodePods["node2"]; ok || len(nodePods) != 1 {
+		t.Errorf("expected node2 filtered out by node selector, got %v", nodePods)
+	}
+}
+
+func genSnapshotTestPod(name, node string, phase v1.PodPhase) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       v1.PodSpec{NodeName: node},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
@@ -0,0 +1,71 @@
+package resources
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// UsageSource measures resource usage of nodes and pods, v1.ResourcePods
+// counts the pods.
+type UsageSource interface {
+	NodeUsage(info NodeInfoWithPods) v1.ResourceList
+	PodUsage(pod *v1.Pod) v1.ResourceList
+}
+
+// UsageValidator is implemented by usage sources which may not cover all
+// nodes of a snapshot.
+type UsageValidator interface {
+	ValidateUsage(nodePods map[string]NodeInfoWithPods) error
+}
+
+// ValidateUsage checks that source covers the snapshot, if it can tell.
+func ValidateUsage(source UsageSource, nodePods map[string]NodeInfoWithPods) error {
+	if v, ok := source.(UsageValidator); ok {
+		return v.ValidateUsage(nodePods)
+	}
+	return nil
+}
+
+// RequestsUsage takes pod requests as usage, the way the scheduler does.
+type RequestsUsage struct{}
+
+func (RequestsUsage) NodeUsage(info NodeInfoWithPods) v1.ResourceList {
+	return PodsRequest(info.Pods)
+}
+
+func (RequestsUsage) PodUsage(pod *v1.Pod) v1.ResourceList {
+	return PodsRequest([]*v1.Pod{pod})
+}
+
+// SampledNodeUsage deducts the usage of pods evicted earlier in the pass
+// from a node sample, which still counts them.
+func SampledNodeUsage(source UsageSource, info NodeInfoWithPods, sample v1.ResourceList) v1.ResourceList {
+	if len(info.Evicted) == 0 {
+		return sample
+	}
+	ret := sample.DeepCopy()
+	for name, qty := range PodsUsage(source, info.Evicted) {
+		v, ok := ret[name]
+		if !ok {
+			continue
+		}
+		v.Sub(qty)
+		if v.Sign() < 0 {
+			v.Set(0)
+		}
+		ret[name] = v
+	}
+	return ret
+}
+
+// PodsUsage sums the usage of pods.
+func PodsUsage(source UsageSource, pods []*v1.Pod) v1.ResourceList {
+	ret := make(v1.ResourceList)
+	for _, pod := range pods {
+		for name, qty := range source.PodUsage(pod) {
+			v := ret[name].DeepCopy()
+			v.Add(qty)
+			ret[name] = v
+		}
+	}
+	return ret
+}
@@ -0,0 +1,159 @@
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	k8sresource "k8s.io/kubernetes/pkg/api/v1/resource"
+)
+
+// LimitFunc returns the resources that may be requested on a node in total,
+// the node allocatable is used when it is nil.
+type LimitFunc func(node *v1.Node) v1.ResourceList
+
+var _ resources.Placer = &Simulator{}
+
+// Simulator places evicted pods onto destination nodes the way the scheduler
+// would, checking nodeSelector, node affinity, taints, host ports and free
+// resources, and reserves the capacity on the chosen node.
+type Simulator struct {
+	nodes []*nodeState
+}
+
+type nodeState struct {
+	node      *v1.Node
+	limit     v1.ResourceList
+	requested v1.ResourceList
+	pods      int64
+	ports     map[string]struct{}
+}
+
+func New(nodePods map[string]resources.NodeInfoWithPods, limit LimitFunc) *Simulator {
+	s := &Simulator{}
+	for _, info := range nodePods {
+		ns := &nodeState{
+			node:      info.Node,
+			limit:     info.Node.Status.Allocatable,
+			requested: make(v1.ResourceList),
+			ports:     make(map[string]struct{}),
+		}
+		if limit != nil {
+			ns.limit = limit(info.Node)
+		}
+		for _, pod := range info.Pods {
+			ns.add(pod)
+		}
+		s.nodes = append(s.nodes, ns)
+	}
+	// stable placement order
+	sort.Slice(s.nodes, func(i, j int) bool { return s.nodes[i].node.Name < s.nodes[j].node.Name })
+	return s
+}
+
+// Place reserves capacity for the pod on the first node it fits on, other
+// than its current node. The reason is set if no node fits.
+func (s *Simulator) Place(pod *v1.Pod) (string, string) {
+	return s.PlaceExcept(pod, nil)
+}
+
+// PlaceExcept is Place skipping the nodes exclude returns a reason for,
+// e.g. nodes already running a replica of the pod.
+func (s *Simulator) PlaceExcept(pod *v1.Pod, exclude func(node string) string) (string, string) {
+	var reasons []string
+	for _, ns := range s.nodes {
+		if ns.node.Name == pod.Spec.NodeName {
+			continue
+		}
+		reason := ns.fits(pod)
+		if reason == "" && exclude != nil {
+			reason = exclude(ns.node.Name)
+		}
+		if reason != "" {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", ns.node.Name, reason))
+			continue
+		}
+		ns.add(pod)
+		return ns.node.Name, ""
+	}
+	if len(reasons) == 0 {
+		return "", "no destination node"
+	}
+	return "", "no destination node fits, " + strings.Join(reasons, "; ")
+}
+
+// Unreserve releases the capacity reserved for the pod on node.
+func (s *Simulator) Unreserve(pod *v1.Pod, node string) {
+	for _, ns := range s.nodes {
+		if ns.node.Name == node {
+			ns.remove(pod)
+			return
+		}
+	}
+}
+
+func (ns *nodeState) fits(pod *v1.Pod) string {
+	if ns.node.Spec.Unschedulable {
+		return "unschedulable"
+	}
+	if !resources.PodMatchesNodeSelectorAndAffinity(pod, ns.node) {
+		return "node selector or affinity mismatch"
+	}
+	if !resources.PodToleratesNodeTaints(pod, ns.node) {
+		return "untolerated taint"
+	}
+	for _, port := range resources.PodHostPorts(pod) {
+		if _, ok := ns.ports[port]; ok {
+			return fmt.Sprintf("host port %s in use", port)
+		}
+	}
+
+	if maxPods, ok := ns.limit[v1.ResourcePods]; ok && ns.pods+1 > maxPods.Value() {
+		return "too many pods"
+	}
+	requests, _ := k8sresource.PodRequestsAndLimits(pod)
+	for name, qty := range requests {
+		if qty.IsZero() {
+			continue
+		}
+		limit, ok := ns.limit[name]
+		if !ok {
+			return fmt.Sprintf("no %s", name)
+		}
+		used := ns.requested[name].DeepCopy()
+		used.Add(qty)
+		if used.Cmp(limit) > 0 {
+			return fmt.Sprintf("insufficient %s", name)
+		}
+	}
+	return ""
+}
+
+func (ns *nodeState) add(pod *v1.Pod) {
+	requests, _ := k8sresource.PodRequestsAndLimits(pod)
+	for name, qty := range requests {
+		used := ns.requested[name].DeepCopy()
+		used.Add(qty)
+		ns.requested[name] = used
+	}
+	ns.pods++
+	for _, port := range resources.PodHostPorts(pod) {
+		ns.ports[port] = struct{}{}
+	}
+}
+
+func (ns *nodeState) remove(pod *v1.Pod) {
+	requests, _ := k8sresource.PodRequestsAndLimits(pod)
+	for name, qty := range requests {
+		used := ns.requested[name].DeepCopy()
+		used.Sub(qty)
+		ns.requested[name] = used
+	}
+	ns.pods--
+	for _, port := range resources.PodHostPorts(pod) {
+		delete(ns.ports, port)
+	}
+}
@@ -0,0 +1,90 @@
+package simulator
+
+import (
+	"testing"
+
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPlace(t *testing.T) {
+	tainted := genNode("node-tainted", 1000, nil)
+	tainted.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	nodePods := map[string]resources.NodeInfoWithPods{
+		"node-busy":    {Node: genNode("node-busy", 1000, nil)},
+		"node-small":   {Node: genNode("node-small", 200, nil)},
+		"node-ssd":     {Node: genNode("node-ssd", 1000, map[string]string{"disk": "ssd"})},
+		"node-tainted": {Node: tainted},
+	}
+	sim := New(nodePods, nil)
+
+	pod := genPod("pod-1", "node-busy", 300)
+	pod.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+	if node, reason := sim.Place(pod); node != "node-ssd" {
+		t.Errorf("expected pod-1 placed on node-ssd, got %q: %s", node, reason)
+	}
+
+	// node-ssd has 700m left, node-small and node-tainted do not fit
+	pod2 := genPod("pod-2", "node-busy", 800)
+	if node, _ := sim.Place(pod2); node != "" {
+		t.Errorf("expected pod-2 fits nowhere, got %q", node)
+	}
+
+	pod3 := genPod("pod-3", "node-busy", 700)
+	if node, reason := sim.Place(pod3); node != "node-ssd" {
+		t.Errorf("expected pod-3 placed on node-ssd, got %q: %s", node, reason)
+	}
+	sim.Unreserve(pod3, "node-ssd")
+	if node, reason := sim.Place(genPod("pod-4", "node-busy", 700)); node != "node-ssd" {
+		t.Errorf("expected pod-4 placed on node-ssd after unreserve, got %q: %s", node, reason)
+	}
+}
+
+func TestPlaceHostPort(t *testing.T) {
+	nodePods := map[string]resources.NodeInfoWithPods{
+		"node-1": {Node: genNode("node-1", 1000, nil)},
+		"node-2": {Node: genNode("node-2", 1000, nil)},
+	}
+	sim := New(nodePods, nil)
+
+	pod := genPod("pod-1", "node-1", 100)
+	pod.Spec.Containers[0].Ports = []v1.ContainerPort{{HostPort: 8080, ContainerPort: 8080}}
+	if node, reason := sim.Place(pod); node != "node-2" {
+		t.Fatalf("expected pod-1 placed on node-2, got %q: %s", node, reason)
+	}
+	pod2 := pod.DeepCopy()
+	pod2.Name = "pod-2"
+	if node, _ := sim.Place(pod2); node != "" {
+		t.Errorf("expected host port conflict, got %q", node)
+	}
+}
+
+func genNode(name string, cpu int64, labels map[string]string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+				v1.ResourceMemory: *resource.NewQuantity(1000, resource.DecimalSI),
+				v1.ResourcePods:   *resource.NewQuantity(110, resource.DecimalSI),
+			},
+		},
+	}
+}
+
+func genPod(name, nodeName string, cpu int64) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: v1.PodSpec{
+			NodeName: nodeName,
+			Containers: []v1.Container{{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: *resource.NewMilliQuantity(cpu, resource.DecimalSI)},
+				},
+			}},
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	clientset "k8s.io/client-go/kubernetes"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// Strategy decides which pods to evict from a snapshot of nodes and pods.
+type Strategy interface {
+	Run(pe *resources.PodEvictor, nodePods map[string]resources.NodeInfoWithPods, rep *report.StrategyReport) error
+}
+
+// Handle carries the dependencies shared by all strategies.
+type Handle struct {
+	Client clientset.Interface
+	// metrics.k8s.io client, nil if not configured
+	MetricsClient metricsclientset.Interface
+}
+
+// Registration describes a strategy, out-of-tree packages register
+// their own from init.
+type Registration struct {
+	Name string
+	// AddFlags registers strategy specific flags, optional
+	AddFlags func(fs *pflag.FlagSet)
+	// Validate checks strategy specific flags, optional
+	Validate func() error
+	New      func(h Handle) (Strategy, error)
+	// Balances marks load balancing strategies, they run on each balance
+	// group on its own. Others see all eligible nodes, e.g. to find a
+	// destination in another node pool.
+	Balances bool
+}
+
+var registry = make(map[string]Registration)
+
+// Register adds a strategy, it panics on empty or duplicated names.
+func Register(r Registration) {
+	if r.Name == "" || r.New == nil {
+		panic("strategy: name and constructor are required")
+	}
+	if _, ok := registry[r.Name]; ok {
+		panic(fmt.Sprintf("strategy: %q registered twice", r.Name))
+	}
+	registry[r.Name] = r
+}
+
+// Names returns the registered strategy names in sorted order.
+func Names() []string {
+	var ret []string
+	for name := range registry {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func AddFlags(fs *pflag.FlagSet) {
+	for _, name := range Names() {
+		if r := registry[name]; r.AddFlags != nil {
+			r.AddFlags(fs)
+		}
+	}
+}
+
+func Validate(name string) error {
+	r, ok := registry[name]
+	if !ok {
+		return fmt.Errorf("unsupported policy %q", name)
+	}
+	if r.Validate == nil {
+		return nil
+	}
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("invalid %q options: %v", name, err)
+	}
+	return nil
+}
+
+// Balances reports whether the strategy balances load, see Registration.
+func Balances(name string) bool {
+	return registry[name].Balances
+}
+
+func New(name string, h Handle) (Strategy, error) {
+	r, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported policy %q", name)
+	}
+	return r.New(h)
+}
@@ -0,0 +1,93 @@
+package strategy
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stepdc/podacrobat/pkg/report"
+	"github.com/stepdc/podacrobat/pkg/resources"
+)
+
+type testStrategy struct{}
+
+func (testStrategy) Run(*resources.PodEvictor, map[string]resources.NodeInfoWithPods, *report.StrategyReport) error {
+	return nil
+}
+
+func withRegistry(t *testing.T, f func()) {
+	saved := registry
+	registry = make(map[string]Registration)
+	defer func() { registry = saved }()
+	f()
+}
+
+func expectPanic(t *testing.T, name string, f func()) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s: expected panic", name)
+		}
+	}()
+	f()
+}
+
+func TestRegistry(t *testing.T) {
+	withRegistry(t, func() {
+		var threshold int
+		var validated bool
+		Register(Registration{
+			Name: "outoftree",
+			AddFlags: func(fs *pflag.FlagSet) {
+				fs.IntVar(&threshold, "outoftree-threshold", 1, "threshold")
+			},
+			Validate: func() error {
+				validated = true
+				if threshold < 0 {
+					return errors.New("negative threshold")
+				}
+				return nil
+			},
+			New: func(Handle) (Strategy, error) { return testStrategy{}, nil },
+		})
+		Register(Registration{Name: "another", Balances: true, New: func(Handle) (Strategy, error) { return testStrategy{}, nil }})
+
+		if names := Names(); !reflect.DeepEqual(names, []string{"another", "outoftree"}) {
+			t.Errorf("expected sorted names, got %v", names)
+		}
+
+		expectPanic(t, "duplicate", func() {
+			Register(Registration{Name: "outoftree", New: func(Handle) (Strategy, error) { return testStrategy{}, nil }})
+		})
+		expectPanic(t, "no name", func() {
+			Register(Registration{New: func(Handle) (Strategy, error) { return testStrategy{}, nil }})
+		})
+		expectPanic(t, "no constructor", func() { Register(Registration{Name: "noctor"}) })
+
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		AddFlags(fs)
+		if err := fs.Parse([]string{"--outoftree-threshold=-1"}); err != nil {
+			t.Fatalf("expected out-of-tree flag registered: %v", err)
+		}
+		if err := Validate("outoftree"); err == nil || !validated || !strings.Contains(err.Error(), "negative threshold") {
+			t.Errorf("expected strategy validation error, got %v", err)
+		}
+		if err := Validate("another"); err != nil {
+			t.Errorf("expected strategy without options valid, got %v", err)
+		}
+
+		if err := Validate("unknown"); err == nil {
+			t.Errorf("expected unknown policy rejected by Validate")
+		}
+		if _, err := New("unknown", Handle{}); err == nil {
+			t.Errorf("expected unknown policy rejected by New")
+		}
+		if s, err := New("outoftree", Handle{}); err != nil || s == nil {
+			t.Errorf("expected strategy built, got %v, %v", s, err)
+		}
+		if !Balances("another") || Balances("outoftree") || Balances("unknown") {
+			t.Errorf("expected only another to balance load")
+		}
+	})
+}
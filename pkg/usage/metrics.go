@@ -0,0 +1,70 @@
+package usage
+
+import (
+	"fmt"
+
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// MetricsUsage reads NodeMetrics and PodMetrics from metrics.k8s.io.
+type MetricsUsage struct {
+	nodes map[string]v1.ResourceList
+	pods  map[string]v1.ResourceList
+}
+
+func NewMetricsUsage(cli metricsclientset.Interface) (*MetricsUsage, error) {
+	if cli == nil {
+		return nil, ErrNoMetricsClient
+	}
+	nodeMetrics, err := cli.MetricsV1beta1().NodeMetricses().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list node metrics failed: %v", err)
+	}
+	podMetrics, err := cli.MetricsV1beta1().PodMetricses(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pod metrics failed: %v", err)
+	}
+
+	m := &MetricsUsage{
+		nodes: make(map[string]v1.ResourceList),
+		pods:  make(map[string]v1.ResourceList),
+	}
+	for _, item := range nodeMetrics.Items {
+		m.nodes[item.Name] = item.Usage
+	}
+	for _, item := range podMetrics.Items {
+		usage := make(v1.ResourceList)
+		for _, c := range item.Containers {
+			for name, qty := range c.Usage {
+				v := usage[name].DeepCopy()
+				v.Add(qty)
+				usage[name] = v
+			}
+		}
+		m.pods[item.Namespace+"/"+item.Name] = usage
+	}
+	return m, nil
+}
+
+// NodeUsage returns the node metrics without the pods evicted earlier in
+// the pass, or the sum of its pods usage if the node has not been scraped
+// yet.
+func (m *MetricsUsage) NodeUsage(info resources.NodeInfoWithPods) v1.ResourceList {
+	if usage, ok := m.nodes[info.Node.Name]; ok {
+		return resources.SampledNodeUsage(m, info, usage)
+	}
+	return resources.PodsUsage(m, info.Pods)
+}
+
+// PodUsage returns the pod metrics, or its requests if the pod has not
+// been scraped yet, e.g. it just started.
+func (m *MetricsUsage) PodUsage(pod *v1.Pod) v1.ResourceList {
+	if usage, ok := m.pods[pod.Namespace+"/"+pod.Name]; ok {
+		return usage
+	}
+	return resources.RequestsUsage{}.PodUsage(pod)
+}
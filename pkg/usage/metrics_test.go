@@ -0,0 +1,127 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	"k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func TestMetricsAndMaxUsage(t *testing.T) {
+	fakeCli := &fake.Clientset{}
+	fakeCli.AddReactor("list", "nodes", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.NodeMetricsList{Items: []metricsv1beta1.NodeMetrics{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Usage: genResourceList(900, 100)},
+		}}, nil
+	})
+	fakeCli.AddReactor("list", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.PodMetricsList{Items: []metricsv1beta1.PodMetrics{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod-1"},
+				Containers: []metricsv1beta1.ContainerMetrics{
+					{Name: "a", Usage: genResourceList(300, 10)},
+					{Name: "b", Usage: genResourceList(200, 10)},
+				},
+			},
+		}}, nil
+	})
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod-1"},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Resources: v1.ResourceRequirements{Requests: genResourceList(100, 50)},
+		}}},
+	}
+	info := resources.NodeInfoWithPods{
+		Node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		Pods: []*v1.Pod{pod},
+	}
+
+	metrics, err := New(Options{Source: SourceMetrics}, fakeCli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podUsage := metrics.PodUsage(pod)
+	if cpu := podUsage.Cpu().MilliValue(); cpu != 500 {
+		t.Errorf("expected pod cpu 500m from metrics, got %dm", cpu)
+	}
+	if pods := podUsage[v1.ResourcePods]; pods.Value() != 1 {
+		t.Errorf("expected pod count from requests, got %v", pods.String())
+	}
+	nodeUsage := metrics.NodeUsage(info)
+	if cpu := nodeUsage.Cpu().MilliValue(); cpu != 900 {
+		t.Errorf("expected node cpu 900m from metrics, got %dm", cpu)
+	}
+
+	max, err := New(Options{Source: SourceMax}, fakeCli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podUsage = max.PodUsage(pod)
+	if cpu, mem := podUsage.Cpu().MilliValue(), podUsage.Memory().Value(); cpu != 500 || mem != 50 {
+		t.Errorf("expected max pod usage 500m/50, got %dm/%d", cpu, mem)
+	}
+}
+
+func TestMetricsUsageMissingSample(t *testing.T) {
+	fakeCli := &fake.Clientset{}
+	fakeCli.AddReactor("list", "nodes", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.NodeMetricsList{}, nil
+	})
+	fakeCli.AddReactor("list", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.PodMetricsList{Items: []metricsv1beta1.PodMetrics{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "scraped"},
+			Containers: []metricsv1beta1.ContainerMetrics{{Name: "a", Usage: genResourceList(300, 10)}},
+		}}}, nil
+	})
+
+	// started after the last scrape, requests are its usage
+	fresh := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "fresh"},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Resources: v1.ResourceRequirements{Requests: genResourceList(100, 50)},
+		}}},
+	}
+	scraped := fresh.DeepCopy()
+	scraped.Name = "scraped"
+	info := resources.NodeInfoWithPods{
+		Node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		Pods: []*v1.Pod{fresh, scraped},
+	}
+
+	for _, source := range []string{SourceMetrics, SourceMax} {
+		s, err := New(Options{Source: source}, fakeCli)
+		if err != nil {
+			t.Fatal(err)
+		}
+		podUsage := s.PodUsage(fresh)
+		if cpu, mem := podUsage.Cpu().MilliValue(), podUsage.Memory().Value(); cpu != 100 || mem != 50 {
+			t.Errorf("%s: expected pod usage 100m/50 from requests, got %dm/%d", source, cpu, mem)
+		}
+		// node not scraped, sum of pods
+		nodeUsage := s.NodeUsage(info)
+		if cpu := nodeUsage.Cpu().MilliValue(); cpu != 400 {
+			t.Errorf("%s: expected node cpu 400m, got %dm", source, cpu)
+		}
+	}
+}
+
+func TestMetricsUsageWithoutClient(t *testing.T) {
+	if _, err := New(Options{Source: SourceMetrics}, nil); err != ErrNoMetricsClient {
+		t.Errorf("expected %v, got %v", ErrNoMetricsClient, err)
+	}
+}
+
+func genResourceList(cpu, mem int64) v1.ResourceList {
+	return v1.ResourceList{
+		v1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+		v1.ResourceMemory: *resource.NewQuantity(mem, resource.DecimalSI),
+	}
+}
@@ -0,0 +1,257 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	AggregationAvg = "avg"
+	AggregationP95 = "p95"
+)
+
+// series from cadvisor, carrying namespace, pod, container and node labels
+const (
+	cpuSeries    = "container_cpu_usage_seconds_total"
+	memorySeries = "container_memory_working_set_bytes"
+	// resolution of p95 subqueries
+	subqueryStep = "1m"
+)
+
+// cadvisor label names, renamed to container and pod in kubernetes 1.16
+const (
+	DefaultContainerLabel = "container_name"
+	DefaultPodLabel       = "pod_name"
+	DefaultNodeLabel      = "node"
+)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type PrometheusOptions struct {
+	URL         string
+	Window      time.Duration
+	Aggregation string
+	Timeout     time.Duration
+	// label names of the cadvisor series
+	ContainerLabel string
+	PodLabel       string
+	NodeLabel      string
+}
+
+func (o *PrometheusOptions) Validate() error {
+	if o.URL == "" {
+		return fmt.Errorf("prometheus url is required")
+	}
+	if _, err := url.Parse(o.URL); err != nil {
+		return fmt.Errorf("illegal prometheus url %q: %v", o.URL, err)
+	}
+	if o.Window < time.Minute {
+		return fmt.Errorf("usage window %v shorter than 1m", o.Window)
+	}
+	if o.Aggregation != AggregationAvg && o.Aggregation != AggregationP95 {
+		return fmt.Errorf("unsupported usage aggregation %q", o.Aggregation)
+	}
+	for _, label := range []string{o.ContainerLabel, o.PodLabel, o.NodeLabel} {
+		if !labelNameRegexp.MatchString(label) {
+			return fmt.Errorf("illegal prometheus label name %q", label)
+		}
+	}
+	return nil
+}
+
+// PrometheusUsage reads cpu & memory usage of nodes and pods, averaged or
+// p95 over a time window, from a prometheus compatible http api.
+type PrometheusUsage struct {
+	nodes map[string]v1.ResourceList
+	pods  map[string]v1.ResourceList
+}
+
+func NewPrometheusUsage(opts PrometheusOptions, cli *http.Client) (*PrometheusUsage, error) {
+	if cli == nil {
+		cli = &http.Client{Timeout: opts.Timeout}
+	}
+	q := &promQuerier{cli: cli, url: strings.TrimSuffix(opts.URL, "/") + "/api/v1/query"}
+	p := &PrometheusUsage{
+		nodes: make(map[string]v1.ResourceList),
+		pods:  make(map[string]v1.ResourceList),
+	}
+
+	type query struct {
+		promql   string
+		resource v1.ResourceName
+		usage    map[string]v1.ResourceList
+		key      func(labels map[string]string) string
+	}
+	podKey := func(labels map[string]string) string {
+		if labels["namespace"] == "" || labels[opts.PodLabel] == "" {
+			return ""
+		}
+		return labels["namespace"] + "/" + labels[opts.PodLabel]
+	}
+	nodeKey := func(labels map[string]string) string { return labels[opts.NodeLabel] }
+	byPod := "namespace, " + opts.PodLabel
+	queries := []query{
+		{cpuQuery(byPod, opts), v1.ResourceCPU, p.pods, podKey},
+		{memoryQuery(byPod, opts), v1.ResourceMemory, p.pods, podKey},
+		{cpuQuery(opts.NodeLabel, opts), v1.ResourceCPU, p.nodes, nodeKey},
+		{memoryQuery(opts.NodeLabel, opts), v1.ResourceMemory, p.nodes, nodeKey},
+	}
+	for _, query := range queries {
+		samples, err := q.query(query.promql)
+		if err != nil {
+			return nil, err
+		}
+		for _, sample := range samples {
+			key := query.key(sample.labels)
+			if key == "" {
+				continue
+			}
+			list, ok := query.usage[key]
+			if !ok {
+				list = make(v1.ResourceList)
+				query.usage[key] = list
+			}
+			if query.resource == v1.ResourceCPU {
+				// cores to millicores
+				list[v1.ResourceCPU] = *resource.NewMilliQuantity(int64(sample.value*1000), resource.DecimalSI)
+			} else {
+				list[v1.ResourceMemory] = *resource.NewQuantity(int64(sample.value), resource.BinarySI)
+			}
+		}
+	}
+	return p, nil
+}
+
+// NodeUsage returns the node usage without the pods evicted earlier in the
+// pass, or the sum of its pods usage if the node has no series.
+func (p *PrometheusUsage) NodeUsage(info resources.NodeInfoWithPods) v1.ResourceList {
+	if usage, ok := p.nodes[info.Node.Name]; ok {
+		return resources.SampledNodeUsage(p, info, usage)
+	}
+	return resources.PodsUsage(p, info.Pods)
+}
+
+// PodUsage returns the pod usage, or its requests if the pod has no
+// series, e.g. it just started.
+func (p *PrometheusUsage) PodUsage(pod *v1.Pod) v1.ResourceList {
+	if usage, ok := p.pods[pod.Namespace+"/"+pod.Name]; ok {
+		return usage
+	}
+	return resources.RequestsUsage{}.PodUsage(pod)
+}
+
+// ValidateUsage fails if a node with pods has neither a series of its own
+// nor of any of its pods, usually the label names do not match the series.
+func (p *PrometheusUsage) ValidateUsage(nodePods map[string]resources.NodeInfoWithPods) error {
+	for name, info := range nodePods {
+		if _, ok := p.nodes[name]; ok || len(info.Pods) == 0 {
+			continue
+		}
+		var sampled bool
+		for _, pod := range info.Pods {
+			if _, ok := p.pods[pod.Namespace+"/"+pod.Name]; ok {
+				sampled = true
+				break
+			}
+		}
+		if !sampled {
+			return fmt.Errorf("no prometheus samples for node %s with %d pods, check the prometheus label flags", name, len(info.Pods))
+		}
+	}
+	return nil
+}
+
+// series selects the containers of the series, leaving out pod sandboxes.
+func series(name string, opts PrometheusOptions) string {
+	return fmt.Sprintf(`%s{%s!="",%s!="POD"}`, name, opts.ContainerLabel, opts.ContainerLabel)
+}
+
+func cpuQuery(by string, opts PrometheusOptions) string {
+	if opts.Aggregation == AggregationP95 {
+		return fmt.Sprintf("quantile_over_time(0.95, sum by (%s) (rate(%s[%s]))[%s:%s])",
+			by, series(cpuSeries, opts), subqueryStep, promDuration(opts.Window), subqueryStep)
+	}
+	return fmt.Sprintf("sum by (%s) (rate(%s[%s]))", by, series(cpuSeries, opts), promDuration(opts.Window))
+}
+
+func memoryQuery(by string, opts PrometheusOptions) string {
+	if opts.Aggregation == AggregationP95 {
+		return fmt.Sprintf("quantile_over_time(0.95, sum by (%s) (%s)[%s:%s])",
+			by, series(memorySeries, opts), promDuration(opts.Window), subqueryStep)
+	}
+	return fmt.Sprintf("sum by (%s) (avg_over_time(%s[%s]))", by, series(memorySeries, opts), promDuration(opts.Window))
+}
+
+func promDuration(d time.Duration) string {
+	return strconv.Itoa(int(d.Seconds())) + "s"
+}
+
+type promSample struct {
+	labels map[string]string
+	value  float64
+}
+
+type promQuerier struct {
+	cli *http.Client
+	url string
+}
+
+type promResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func (q *promQuerier) query(promql string) ([]promSample, error) {
+	resp, err := q.cli.PostForm(q.url, url.Values{"query": {promql}})
+	if err != nil {
+		return nil, fmt.Errorf("query prometheus failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var pr promResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return nil, fmt.Errorf("decode prometheus response failed, status %d: %v", resp.StatusCode, err)
+	}
+	if pr.Status != "success" {
+		return nil, fmt.Errorf("prometheus query %q failed: %s", promql, pr.Error)
+	}
+	if pr.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("unexpected prometheus result type %q", pr.Data.ResultType)
+	}
+
+	var ret []promSample
+	for _, r := range pr.Data.Result {
+		if len(r.Value) != 2 {
+			continue
+		}
+		s, ok := r.Value[1].(string)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		ret = append(ret, promSample{labels: r.Metric, value: v})
+	}
+	return ret, nil
+}
@@ -0,0 +1,131 @@
+package usage
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrometheusUsage(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.FormValue("query")
+		queries = append(queries, query)
+
+		var result string
+		switch {
+		case strings.Contains(query, "by (namespace, pod_name)") && strings.Contains(query, "cpu"):
+			result = `{"metric":{"namespace":"default","pod_name":"pod-1"},"value":[1550000000,"0.25"]}`
+		case strings.Contains(query, "by (namespace, pod_name)"):
+			result = `{"metric":{"namespace":"default","pod_name":"pod-1"},"value":[1550000000,"1048576"]}`
+		case strings.Contains(query, "cpu"):
+			result = `{"metric":{"node":"node-1"},"value":[1550000000,"1.5"]},{"metric":{"node":"node-2"},"value":[1550000000,"NaN"]}`
+		default:
+			result = `{"metric":{"node":"node-1"},"value":[1550000000,"2097152"]}`
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, result)
+	}))
+	defer srv.Close()
+
+	opts := PrometheusOptions{URL: srv.URL, Window: 15 * time.Minute, Aggregation: AggregationP95,
+		ContainerLabel: DefaultContainerLabel, PodLabel: DefaultPodLabel, NodeLabel: DefaultNodeLabel}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPrometheusUsage(opts, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 4 {
+		t.Fatalf("expected 4 queries, got %d", len(queries))
+	}
+	for _, q := range queries {
+		if !strings.Contains(q, "quantile_over_time(0.95") || !strings.Contains(q, "900s") {
+			t.Errorf("expected p95 over 900s, got query %q", q)
+		}
+		if !strings.Contains(q, `container_name!="POD"`) {
+			t.Errorf("expected container_name label, got query %q", q)
+		}
+	}
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod-1"}}
+	podUsage := p.PodUsage(pod)
+	if cpu, mem := podUsage.Cpu().MilliValue(), podUsage.Memory().Value(); cpu != 250 || mem != 1048576 {
+		t.Errorf("expected pod usage 250m/1Mi, got %dm/%d", cpu, mem)
+	}
+
+	nodeUsage := p.NodeUsage(resources.NodeInfoWithPods{Node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}})
+	if cpu, mem := nodeUsage.Cpu().MilliValue(), nodeUsage.Memory().Value(); cpu != 1500 || mem != 2097152 {
+		t.Errorf("expected node usage 1500m/2Mi, got %dm/%d", cpu, mem)
+	}
+	// pod-1 was evicted by an earlier policy, the sample still counts it
+	nodeUsage = p.NodeUsage(resources.NodeInfoWithPods{Node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}, Evicted: []*v1.Pod{pod}})
+	if cpu, mem := nodeUsage.Cpu().MilliValue(), nodeUsage.Memory().Value(); cpu != 1250 || mem != 1048576 {
+		t.Errorf("expected node usage without pod-1 1250m/1Mi, got %dm/%d", cpu, mem)
+	}
+
+	// no usable node series, fall back to the pods on it
+	nodeUsage = p.NodeUsage(resources.NodeInfoWithPods{
+		Node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+		Pods: []*v1.Pod{pod},
+	})
+	if cpu := nodeUsage.Cpu().MilliValue(); cpu != 250 {
+		t.Errorf("expected node-2 usage from pods 250m, got %dm", cpu)
+	}
+
+	// a pod without series counts by its requests
+	fresh := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "fresh"},
+		Spec: v1.PodSpec{Containers: []v1.Container{{Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+		}}}},
+	}
+	freshUsage := p.PodUsage(fresh)
+	if cpu := freshUsage.Cpu().MilliValue(); cpu != 100 {
+		t.Errorf("expected fresh pod usage from requests 100m, got %dm", cpu)
+	}
+
+	// node-3 and its pod have no series at all
+	nodePods := map[string]resources.NodeInfoWithPods{
+		"node-1": {Node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}, Pods: []*v1.Pod{fresh}},
+		"node-2": {Node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}, Pods: []*v1.Pod{pod}},
+	}
+	if err := p.ValidateUsage(nodePods); err != nil {
+		t.Errorf("expected usage valid, got %v", err)
+	}
+	nodePods["node-3"] = resources.NodeInfoWithPods{Node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-3"}}, Pods: []*v1.Pod{fresh}}
+	if err := resources.ValidateUsage(&FallbackUsage{source: p, fallback: resources.RequestsUsage{}}, nodePods); err == nil {
+		t.Errorf("expected node-3 without samples rejected")
+	}
+
+	opts.PodLabel = "pod-name"
+	if err := opts.Validate(); err == nil {
+		t.Errorf("expected illegal label name rejected")
+	}
+}
+
+func TestPrometheusUsageQueryError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+	}))
+	defer srv.Close()
+
+	opts := PrometheusOptions{URL: srv.URL, Window: 10 * time.Minute, Aggregation: AggregationAvg}
+	if _, err := NewPrometheusUsage(opts, srv.Client()); err == nil {
+		t.Error("expected query error")
+	}
+}
@@ -0,0 +1,156 @@
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stepdc/podacrobat/pkg/resources"
+
+	v1 "k8s.io/api/core/v1"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+const (
+	// pod requests, what the scheduler sees
+	SourceRequests = "requests"
+	// real usage from metrics.k8s.io
+	SourceMetrics = "metrics"
+	// max of requests and metrics per resource
+	SourceMax = "max"
+	// usage over a time window from prometheus
+	SourcePrometheus = "prometheus"
+)
+
+var ErrNoMetricsClient = errors.New("metrics client is required")
+
+type Options struct {
+	Source     string
+	Prometheus PrometheusOptions
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Source, "usage-source", SourceRequests,
+		"how node and pod usage is measured, one of: requests, metrics(metrics.k8s.io), max(max of requests and metrics), prometheus")
+	fs.StringVar(&o.Prometheus.URL, "prometheus-url", "", "prometheus compatible api address for --usage-source=prometheus")
+	fs.DurationVar(&o.Prometheus.Window, "usage-window", 10*time.Minute, "time window usage is smoothed over for --usage-source=prometheus")
+	fs.StringVar(&o.Prometheus.Aggregation, "usage-aggregation", AggregationAvg, "how usage is aggregated over the window, one of: avg, p95")
+	fs.DurationVar(&o.Prometheus.Timeout, "prometheus-timeout", 30*time.Second, "timeout of prometheus queries")
+	fs.StringVar(&o.Prometheus.ContainerLabel, "prometheus-container-label", DefaultContainerLabel,
+		"container label of the cadvisor series, container since kubernetes 1.16")
+	fs.StringVar(&o.Prometheus.PodLabel, "prometheus-pod-label", DefaultPodLabel, "pod label of the cadvisor series, pod since kubernetes 1.16")
+	fs.StringVar(&o.Prometheus.NodeLabel, "prometheus-node-label", DefaultNodeLabel, "node label of the cadvisor series")
+}
+
+func (o *Options) Validate() error {
+	switch o.Source {
+	case SourceRequests, SourceMetrics, SourceMax:
+		return nil
+	case SourcePrometheus:
+		return o.Prometheus.Validate()
+	}
+	return fmt.Errorf("unsupported usage source %q", o.Source)
+}
+
+// New builds the usage source, metrics are fetched once here so all
+// decisions of a run see the same numbers.
+func New(opts Options, metricsCli metricsclientset.Interface) (resources.UsageSource, error) {
+	switch opts.Source {
+	case SourceRequests, "":
+		return resources.RequestsUsage{}, nil
+	case SourceMetrics:
+		metrics, err := NewMetricsUsage(metricsCli)
+		if err != nil {
+			return nil, err
+		}
+		return &FallbackUsage{source: metrics, fallback: resources.RequestsUsage{}}, nil
+	case SourceMax:
+		metrics, err := NewMetricsUsage(metricsCli)
+		if err != nil {
+			return nil, err
+		}
+		return &MaxUsage{sources: []resources.UsageSource{resources.RequestsUsage{}, metrics}}, nil
+	case SourcePrometheus:
+		prom, err := NewPrometheusUsage(opts.Prometheus, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &FallbackUsage{source: prom, fallback: resources.RequestsUsage{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported usage source %q", opts.Source)
+}
+
+// FallbackUsage takes resources its source does not measure, like pod
+// count or extended resources, from the fallback.
+type FallbackUsage struct {
+	source, fallback resources.UsageSource
+}
+
+func (f *FallbackUsage) NodeUsage(info resources.NodeInfoWithPods) v1.ResourceList {
+	return mergeResourceList(f.source.NodeUsage(info), f.fallback.NodeUsage(info))
+}
+
+func (f *FallbackUsage) PodUsage(pod *v1.Pod) v1.ResourceList {
+	return mergeResourceList(f.source.PodUsage(pod), f.fallback.PodUsage(pod))
+}
+
+func (f *FallbackUsage) ValidateUsage(nodePods map[string]resources.NodeInfoWithPods) error {
+	return resources.ValidateUsage(f.source, nodePods)
+}
+
+func mergeResourceList(list, fallback v1.ResourceList) v1.ResourceList {
+	ret := list.DeepCopy()
+	if ret == nil {
+		ret = make(v1.ResourceList)
+	}
+	for name, qty := range fallback {
+		if _, ok := ret[name]; !ok {
+			ret[name] = qty.DeepCopy()
+		}
+	}
+	return ret
+}
+
+// MaxUsage takes the max value of its sources per resource.
+type MaxUsage struct {
+	sources []resources.UsageSource
+}
+
+func (m *MaxUsage) NodeUsage(info resources.NodeInfoWithPods) v1.ResourceList {
+	var lists []v1.ResourceList
+	for _, s := range m.sources {
+		lists = append(lists, s.NodeUsage(info))
+	}
+	return maxResourceList(lists)
+}
+
+func (m *MaxUsage) ValidateUsage(nodePods map[string]resources.NodeInfoWithPods) error {
+	for _, s := range m.sources {
+		if err := resources.ValidateUsage(s, nodePods); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MaxUsage) PodUsage(pod *v1.Pod) v1.ResourceList {
+	var lists []v1.ResourceList
+	for _, s := range m.sources {
+		lists = append(lists, s.PodUsage(pod))
+	}
+	return maxResourceList(lists)
+}
+
+func maxResourceList(lists []v1.ResourceList) v1.ResourceList {
+	ret := make(v1.ResourceList)
+	for _, list := range lists {
+		for name, qty := range list {
+			if v, ok := ret[name]; ok && v.Cmp(qty) >= 0 {
+				continue
+			}
+			ret[name] = qty.DeepCopy()
+		}
+	}
+	return ret
+}